@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/triamazikamno/tinkoff-invest/internal/bot"
 	"github.com/triamazikamno/tinkoff-invest/internal/db"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -23,6 +24,8 @@ var (
 	postgresPassword = kingpin.Flag("postgres-password", "Postgresql password").String()
 	postgresHost     = kingpin.Flag("postgres-host", "Postgresql host").String()
 	postgresDatabase = kingpin.Flag("postgres-db", "Postgresql database").String()
+	admins           = kingpin.Flag("admin", "Telegram chat ID allowed to use service commands, repeatable").Int64List()
+	baseCurrency     = kingpin.Flag("base-currency", "Currency consolidated portfolio totals are shown in").Default("RUB").Enum("RUB", "USD", "EUR")
 )
 
 func main() {
@@ -75,7 +78,7 @@ func main() {
 				log.Fatal().Err(err).Msg("failed to subscribe to tg updates")
 			}
 		}
-		botapi := bot.NewBot(database, tbot, log, *apiKey)
+		botapi := bot.NewBot(database, tbot, log, *apiKey, *admins, tinkoffinvest.Currency(*baseCurrency))
 		botapi.Start(updates)
 		allPriceWatchers, err := database.PriceWatchList(0)
 		if err != nil {
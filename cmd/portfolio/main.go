@@ -10,14 +10,28 @@ import (
 
 	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
 	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	format    = kingpin.Flag("format", "Output format: bitbar for the menu bar plugin, csv or json for the full portfolio report").Default("bitbar").Enum("bitbar", "csv", "json")
+	accountID = kingpin.Flag("account", "Account ID, the main broker account by default").String()
+	cacheDir  = kingpin.Flag("operations-cache", "Directory to keep downloaded operations in, so only new ones are fetched next time").String()
+	since     = kingpin.Flag("history-start", "Date the account was opened as YYYY-MM-DD, speeds up the first download of operations").String()
+	base      = kingpin.Flag("base-currency", "Currency consolidated totals are converted to").Default("RUB").Enum("RUB", "USD", "EUR")
 )
 
 func main() {
+	kingpin.Parse()
 	apiKey, ok := os.LookupEnv("API_KEY")
 	if !ok || apiKey == "" {
 		log.Fatal("please specify API_KEY variable")
 		return
 	}
+	if *format != "bitbar" {
+		export(apiKey)
+		return
+	}
 	ti := sdk.NewRestClient(apiKey)
 	positions, err := ti.Portfolio(context.Background(), sdk.DefaultAccount)
 	if err != nil {
@@ -81,3 +95,31 @@ func main() {
 		}
 	}
 }
+
+func export(apiKey string) {
+	ti := tinkoffinvest.NewAPI(apiKey)
+	if *cacheDir != "" {
+		ti.OperationsStore = tinkoffinvest.FileOperationsStore{Dir: *cacheDir}
+	}
+	if *since != "" {
+		start, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			log.Fatalf("invalid history start: %v", err)
+			return
+		}
+		ti.HistoryStart = start
+	}
+	portfolio, err := ti.Portfolio(context.Background(), *accountID, tinkoffinvest.PortfolioOptions{BaseCurrency: tinkoffinvest.Currency(*base)})
+	if err != nil {
+		log.Fatalf("failed to get portfolio: %v", err)
+		return
+	}
+	if *format == "json" {
+		err = portfolio.WriteJSON(os.Stdout)
+	} else {
+		err = portfolio.WriteCSV(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("failed to export portfolio: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/TinkoffCreditSystems/invest-openapi-go-sdk v0.4.0
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
+	github.com/gorilla/websocket v1.4.1
 	github.com/jackc/pgx v3.6.0+incompatible
 	github.com/pkg/errors v0.9.1
 	github.com/pplcc/plotext v0.0.0-20180221170324-68ab3c6e05c3
@@ -22,7 +23,6 @@ require (
 	github.com/fogleman/gg v1.2.1-0.20190220221249-0403632d5b90 // indirect
 	github.com/gofrs/uuid v3.2.0+incompatible // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/gorilla/websocket v1.4.1 // indirect
 	github.com/jackc/fake v0.0.0-20150926172116-812a484cc733 // indirect
 	github.com/jung-kurt/gofpdf v1.0.3-0.20190309125859-24315acbbda5 // indirect
 	github.com/lib/pq v1.3.0 // indirect
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+func accountName(acc sdk.Account) string {
+	switch acc.Type {
+	case sdk.AccountTinkoff:
+		return "Брокерский счет"
+	case sdk.AccountTinkoffIIS:
+		return "ИИС"
+	default:
+		return string(acc.Type)
+	}
+}
+
+// findAccount matches an account by its number in /accounts list, ID or type.
+func findAccount(accounts []sdk.Account, query string) (sdk.Account, bool) {
+	// account IDs are numeric too, so only short numbers are treated as list positions
+	if n, err := strconv.Atoi(query); err == nil && len(query) < 4 && n >= 1 && n <= len(accounts) {
+		return accounts[n-1], true
+	}
+	query = strings.ToLower(query)
+	for _, acc := range accounts {
+		if strings.ToLower(acc.ID) == query || strings.ToLower(string(acc.Type)) == query {
+			return acc, true
+		}
+		if query == "iis" || query == "иис" {
+			if acc.Type == sdk.AccountTinkoffIIS {
+				return acc, true
+			}
+		}
+	}
+	return sdk.Account{}, false
+}
+
+// resolveAccounts picks accounts a portfolio command applies to: the one given in args,
+// otherwise the default account of the chat, otherwise all of them.
+func (bot *Bot) resolveAccounts(ctx context.Context, chatID int64, ti *tinkoffinvest.TinkoffInvest, args []string) ([]sdk.Account, error) {
+	accounts, err := ti.RestClient.Accounts(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get accounts")
+	}
+	if len(args) > 0 {
+		acc, ok := findAccount(accounts, args[0])
+		if !ok {
+			return nil, errors.Errorf("счет %s не найден, список счетов: /accounts", args[0])
+		}
+		return []sdk.Account{acc}, nil
+	}
+	if bot.db.IsSet() {
+		if defaultID, err := bot.db.DefaultAccount(chatID); err == nil && defaultID != "" {
+			for _, acc := range accounts {
+				if acc.ID == defaultID {
+					return []sdk.Account{acc}, nil
+				}
+			}
+		}
+	}
+	return accounts, nil
+}
+
+func (bot *Bot) handleAccounts(ctx context.Context, chatID int64, args []string) {
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	accounts, err := tinkoffinvest.NewAPI(apiKey).RestClient.Accounts(ctx)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	if len(args) > 0 {
+		acc, ok := findAccount(accounts, args[0])
+		if !ok {
+			bot.sendError(chatID, "Счет не найден")
+			return
+		}
+		if !bot.db.IsSet() {
+			bot.sendError(chatID, "Сохранение счета по умолчанию недоступно без базы данных")
+			return
+		}
+		if err := bot.db.SetDefaultAccount(chatID, acc.ID); err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Не удалось сохранить счет по умолчанию(%v)", err))
+			return
+		}
+		bot.accountCache.Store(chatID, acc.ID)
+		bot.sendText(chatID, fmt.Sprintf("Счет по умолчанию: %s %s", accountName(acc), acc.ID), false)
+		return
+	}
+	var defaultID string
+	if bot.db.IsSet() {
+		defaultID, _ = bot.db.DefaultAccount(chatID)
+	}
+	msg := "Счета:\n"
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(accounts))
+	for i, acc := range accounts {
+		mark := ""
+		if acc.ID == defaultID {
+			mark = " (по умолчанию)"
+		}
+		msg += fmt.Sprintf("%d. %s %s%s\n", i+1, accountName(acc), acc.ID, mark)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(accountName(acc)+" "+acc.ID, "accounts "+acc.ID),
+		))
+	}
+	msg += "\nВыберите счет по умолчанию для /summary, /fullreport и /wl или укажите его номер: /accounts 2"
+	botMsg := botMessage(tgbotapi.NewMessage(chatID, msg), false)
+	botMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := bot.tg.Send(botMsg); err != nil {
+		bot.log.Err(err).Int64("chatID", chatID).Msg("failed to send telegram message")
+	}
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// allocationTopPositions is how many positions get their own slice on the chart.
+const allocationTopPositions = 9
+
+func (bot *Bot) handleAllocation(ctx context.Context, chatID int64, args []string) {
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		data, err := ti.PortfolioData(ctx, acc.ID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		allocation := tinkoffinvest.BuildAllocation(data, bot.baseCurrency, nil)
+		if allocation.Total <= 0 {
+			bot.sendText(chatID, string(acc.Type)+":\nПортфель пуст", false)
+			continue
+		}
+		bot.sendText(chatID, "```\n"+string(acc.Type)+":\n"+allocation.Summary()+"```", true)
+
+		for _, chart := range []struct {
+			title  string
+			slices []tinkoffinvest.AllocationSlice
+		}{
+			{"по типу", allocation.ByType},
+			{"по валюте", allocation.ByCurrency},
+			{"по позициям", tinkoffinvest.TopSlices(allocation.ByPosition, allocationTopPositions)},
+		} {
+			if len(chart.slices) < 2 {
+				continue
+			}
+			title := fmt.Sprintf("%s %s", acc.Type, chart.title)
+			fi, err := pieChart(title, chart.slices)
+			if err != nil {
+				// the text above already has the same numbers
+				bot.log.Err(err).Int64("chatID", chatID).Msg("failed to render allocation chart")
+				continue
+			}
+			_, _ = bot.tg.Send(
+				tgbotapi.NewPhotoUpload(
+					chatID, tgbotapi.FileReader{Name: title, Reader: fi, Size: -1}),
+			)
+		}
+	}
+}
+
+// pieChart draws slices as a pie with a legend on the right, gonum/plot has no pie plotter.
+func pieChart(title string, slices []tinkoffinvest.AllocationSlice) (io.Reader, error) {
+	const width, height = 387, 258
+	titleFont, err := vg.MakeFont("Helvetica", vg.Points(12))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load font")
+	}
+	legendFont, err := vg.MakeFont("Helvetica", vg.Points(9))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load font")
+	}
+	img := vgimg.New(width, height)
+	img.SetColor(color.Black)
+
+	titleWidth := titleFont.Width(title)
+	img.FillString(titleFont, vg.Point{X: (width - titleWidth) / 2, Y: height - titleFont.Extents().Height - 4}, title)
+
+	radius := vg.Length(100)
+	center := vg.Point{X: radius + 12, Y: (height-titleFont.Extents().Height-8)/2 + 2}
+	angle := math.Pi / 2
+	legendY := height - titleFont.Extents().Height - 24
+	for i, slice := range slices {
+		sweep := -2 * math.Pi * slice.Weight / 100
+		var p vg.Path
+		p.Move(center)
+		p.Arc(center, radius, angle, sweep)
+		p.Close()
+		img.SetColor(plotutil.Color(i))
+		img.Fill(p)
+		angle += sweep
+
+		var box vg.Path
+		box.Move(vg.Point{X: 2*radius + 32, Y: legendY})
+		box.Line(vg.Point{X: 2*radius + 40, Y: legendY})
+		box.Line(vg.Point{X: 2*radius + 40, Y: legendY + 8})
+		box.Line(vg.Point{X: 2*radius + 32, Y: legendY + 8})
+		box.Close()
+		img.Fill(box)
+		img.SetColor(color.Black)
+		img.FillString(legendFont, vg.Point{X: 2*radius + 44, Y: legendY}, fmt.Sprintf("%s %.1f%%", slice.Name, slice.Weight))
+		legendY -= legendFont.Extents().Height + 4
+	}
+
+	png := vgimg.PngCanvas{Canvas: img}
+	r, w := io.Pipe()
+	go func(w *io.PipeWriter) {
+		_, _ = png.WriteTo(w)
+		w.Close()
+	}(w)
+
+	return r, nil
+}
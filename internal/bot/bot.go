@@ -31,24 +31,38 @@ type TinkoffAPI interface {
 }
 
 type Bot struct {
-	tg                 *tgbotapi.BotAPI
-	db                 db.Database
-	streamingClients   map[int64]*tinkoffinvest.StreamingClient
-	streamingClientsMu sync.Mutex
-	log                zerolog.Logger
-	defaultApiKey      string
-	dataCache          dataCache
-	earners            earners
-	accountCache       sync.Map
+	tg              *tgbotapi.BotAPI
+	db              db.Database
+	streaming       *tinkoffinvest.StreamingPool
+	candleWatches   map[int64]map[string]*candleWatch
+	candleWatchesMu sync.Mutex
+	log             zerolog.Logger
+	defaultApiKey   string
+	dataCache       dataCache
+	earners         earners
+	accountCache    sync.Map
+	// admins are chats allowed to see service commands like /status
+	admins map[int64]struct{}
+	// baseCurrency is what consolidated totals are converted to
+	baseCurrency tinkoffinvest.Currency
 }
 
-func NewBot(db db.Database, tbot *tgbotapi.BotAPI, log zerolog.Logger, defaultApiKey string) *Bot {
+func NewBot(
+	db db.Database, tbot *tgbotapi.BotAPI, log zerolog.Logger, defaultApiKey string, admins []int64,
+	baseCurrency tinkoffinvest.Currency,
+) *Bot {
 	bot := &Bot{
-		db:               db,
-		tg:               tbot,
-		streamingClients: make(map[int64]*tinkoffinvest.StreamingClient),
-		log:              log,
-		defaultApiKey:    defaultApiKey,
+		db:            db,
+		tg:            tbot,
+		streaming:     tinkoffinvest.NewStreamingPool(log.With().Str("module", "streaming").Logger()),
+		candleWatches: make(map[int64]map[string]*candleWatch),
+		log:           log,
+		defaultApiKey: defaultApiKey,
+		admins:        make(map[int64]struct{}),
+		baseCurrency:  baseCurrency,
+	}
+	for _, chatID := range admins {
+		bot.admins[chatID] = struct{}{}
 	}
 	return bot
 }
@@ -71,7 +85,7 @@ func (bot *Bot) handleHelp(chatID int64) {
 		*/w AAPL 1%*  _Будет присылать уведомление каждый раз, когда цена на акцию Apple изменится на 1%_
 		*/w TWTR \=30* _Пришлет уведомление, когда цена на акцию Twitter достигнет или пересечет $30_
 
-*/wl* \- Список отслеживаемых инструментов
+*/wl \[счет\]* \- Список отслеживаемых инструментов
 
 */wd \<тикер\>* \- Удалить инструмент из отслеживания
 Примеры использованя:
@@ -104,14 +118,65 @@ func (bot *Bot) handleHelp(chatID int64) {
 		1mob \- размерность бара в 1 месяц
 
 *Команды, требующие указание ключа API для Тинькофф Инвестиций:*
-_На данный момент Тинькофф не предоставляет возможности разграничивать права доступа для ключей, а также поддерживается работа только с основным счетом, без ИИС\.
+_На данный момент Тинькофф не предоставляет возможности разграничивать права доступа для ключей\.
 Используйте на свой страх и риск \(ключ позволяет создавать заявки на покупку/продажу, теоретически можно напакостить, если ключ попадет в плохие руки\)_
 
 */apikey* \- Задать API ключ \( см\. как получить на https://tinkoffcreditsystems\.github\.io/invest\-openapi/auth/\#\_2 \)
 
-*/summary* \- Сводка по прибыли в портфеле
+*/accounts \[счет\]* \- Список счетов и выбор счета по умолчанию
+	Примеры использования:
+		*/accounts* _Выведет список счетов с кнопками выбора_
+		*/accounts 2* _Сделает второй счет из списка счетом по умолчанию_
+
+*/summary \[счет\]* \- Сводка по прибыли в портфеле
+
+*/fullreport \[счет\]* \- Детальные данные прибыли по открытым и закрытым позициям
+
+*/export \[csv\|json\] \[счет\]* \- Выгрузить данные */fullreport* файлами, включая сделки и открытые лоты
+
+_Счет можно указать номером из /accounts, идентификатором или типом \(iis\)\. Без указания используется счет по умолчанию, а если он не выбран \- все счета\._
+
+*/transfer \<тикер\> \<цена\>* \- Задать цену покупки бумаг, переведенных от другого брокера, для расчета прибыли
+	Примеры использования:
+		*/transfer AAPL 123\.45* _Бумаги Apple, зачисленные переводом, будут учтены по цене $123\.45_
+		*/transfer AAPL \-* _Удалит цену_
+		*/transfer* _Выведет заданные цены_
 
-*/fullreport* \- Детальные данные прибыли по открытым и закрытым позициям
+*/ca \<тикер\|figi\> \<коэффициент\> \<дата\> \[новый тикер\|figi\]* \- Учесть сплит или замену инструмента в истории операций
+	Примеры использования:
+		*/ca AAPL 4:1 2020\-08\-31* _Сплит акций Apple 4 к 1_
+		*/ca BBG000000001 1 2021\-01\-15 NEWT* _Операции со старым FIGI до указанной даты будут учтены как операции с NEWT_
+		*/ca* _Выведет список, удаление: /ca delete \<номер\>_
+
+*/returns \[счет\]* \- Доходность вложений с учетом пополнений и выводов \(XIRR и TWR\)
+
+*/equity \[период\] \[счет\]* \- График стоимости портфеля с отметками пополнений и выводов
+	Примеры использования:
+		*/equity* _За все время_
+		*/equity 90d* _За последние 90 дней_
+		*/equity 90d iis* _ИИС за последние 90 дней_
+
+*/allocation \[счет\]* \- Распределение портфеля по типам инструментов, валютам и позициям в рублях с круговыми диаграммами
+
+*/rebalance \[сумма\] \[счет\]* \- План покупок и продаж целыми лотами для приведения портфеля к целевым весам с учетом свободных денег на счете и суммы для покупок в рублях
+	Примеры использования:
+		*/rebalance set AAPL 10* _Задать вес Apple 10% портфеля_
+		*/rebalance set AAPL 0* _Продать Apple полностью_
+		*/rebalance set bonds 40* _Задать вес облигаций \(также stocks, etfs\) 40%, распределяется между облигациями в портфеле без своего веса_
+		*/rebalance delete AAPL* _Удалить вес_
+		*/rebalance 50000* _План с учетом ₽50000 для покупок_
+
+*/risk \[период\] \[бенчмарк\] \[счет\]* \- Годовая волатильность, максимальная просадка и бета относительно бенчмарка \(по умолчанию FXRL\) по дневным свечам для каждой позиции и для портфеля с текущими весами
+	Примеры использования:
+		*/risk* _За последний год_
+		*/risk 1095d TMOS* _За 3 года относительно TMOS_
+
+*/dividends \[счет\]* \- Прогноз дивидендов и купонов по текущим позициям на 12 месяцев с графиком по месяцам\. Строится по истории выплат: последняя сумма на бумагу повторяется с обычным для нее интервалом
+
+*/taxreport \[год\] \[счет\]* \- Налоговый отчет за год в CSV и XLSX: прибыль по сделкам в рублях по курсу на даты покупки и продажи, дивиденды и купоны с налогом у источника, налог, удержанный брокером
+	Примеры использования:
+		*/taxreport* _Отчет за прошлый год_
+		*/taxreport 2020 iis* _Отчет за 2020 год по ИИС_
 `,
 		true,
 	)
@@ -121,22 +186,36 @@ func (bot *Bot) handleStop(chatID int64) {
 	if err := bot.db.DeleteApiKey(chatID); err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить API ключ: %v", err))
 	}
-	client := bot.StreamingWorker(chatID)
-	if client != nil {
-		pricewatchers, err := bot.db.PriceWatchList(chatID)
-		if err != nil {
-			bot.sendError(chatID, fmt.Sprintf("Не удалось удалить получить список отслеживания: %v", err))
-		}
-		for _, pw := range pricewatchers {
-			client.UnsubscribeCandles(pw.FIGI, chatID)
-		}
+	pricewatchers, err := bot.db.PriceWatchList(chatID)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить получить список отслеживания: %v", err))
 	}
 	if err := bot.db.PriceWatchDeleteAll(chatID); err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить списки отслеживания: %v", err))
 	}
+	// streams are cancelled only once their watchers are gone
+	for _, pw := range pricewatchers {
+		bot.unwatchCandles(chatID, pw.FIGI)
+	}
 	if err := bot.db.UnSubscribePriceDaily(chatID); err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить глобальное отслеживание: %v", err))
 	}
+	if err := bot.db.DeleteOperations(chatID); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить историю операций: %v", err))
+	}
+	if err := bot.db.DeleteDefaultAccount(chatID); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить счет по умолчанию: %v", err))
+	}
+	if err := bot.db.DeleteTransferPrices(chatID); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить цены покупки: %v", err))
+	}
+	if err := bot.db.DeleteCorporateActions(chatID); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить корпоративные действия: %v", err))
+	}
+	if err := bot.db.DeleteTargetWeights(chatID); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Не удалось удалить целевые веса: %v", err))
+	}
+	bot.accountCache.Delete(chatID)
 	bot.sendText(chatID, "Данные удалены", false)
 }
 
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+// handleCorporateAction records splits and instrument changes the portfolio history is replayed with.
+func (bot *Bot) handleCorporateAction(ctx context.Context, chatID int64, args []string) {
+	if !bot.db.IsSet() {
+		bot.sendError(chatID, "Корпоративные действия недоступны без базы данных")
+		return
+	}
+	if len(args) == 0 {
+		actions, err := bot.db.CorporateActions(chatID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения корпоративных действий(%v)", err))
+			return
+		}
+		msg := "Пример: */ca AAPL 4:1 2020\\-08\\-31* \\- сплит 4 к 1\n" +
+			"*/ca BBG000000001 1 2021\\-01\\-15 NEWT* \\- замена инструмента\n" +
+			"Удаление: */ca delete 3*\n"
+		for _, action := range actions {
+			line := fmt.Sprintf("%d. %s %s", action.ID, action.Date.In(loc).Format("2006-01-02"), action.OldFIGI)
+			if action.NewFIGI != "" {
+				line += " -> " + action.NewFIGI
+			}
+			line += fmt.Sprintf(" x%g", action.Ratio)
+			msg += markDownEscape.Replace(line) + "\n"
+		}
+		bot.sendText(chatID, msg, true)
+		return
+	}
+	if args[0] == "delete" {
+		if len(args) < 2 {
+			bot.sendError(chatID, "Не указан номер. Пример: /ca delete 3")
+			return
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			bot.sendError(chatID, "Не удалось интерпретировать номер")
+			return
+		}
+		if err := bot.db.DeleteCorporateAction(chatID, id); err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка удаления корпоративного действия(%v)", err))
+			return
+		}
+		bot.sendText(chatID, "Удаление успешно", false)
+		return
+	}
+	if len(args) < 3 {
+		bot.sendError(chatID, "Ошибка: не указан тикер, коэффициент или дата. Пример: /ca AAPL 4:1 2020-08-31")
+		return
+	}
+	// corporate actions only change the chat's own portfolio, so like /transfer they need its key
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := tinkoffinvest.NewAPI(apiKey)
+	var action tinkoffinvest.CorporateAction
+	var err error
+	action.OldFIGI, err = instrumentFIGI(ctx, ti, args[0])
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Тикер не найден(%v)", err))
+		return
+	}
+	action.Ratio, err = parseRatio(args[1])
+	if err != nil {
+		bot.sendError(chatID, "Не удалось интерпретировать коэффициент. Пример: 4:1")
+		return
+	}
+	action.Date, err = time.ParseInLocation("2006-01-02", args[2], loc)
+	if err != nil {
+		bot.sendError(chatID, "Не удалось интерпретировать дату. Пример: 2020-08-31")
+		return
+	}
+	if len(args) > 3 {
+		action.NewFIGI, err = instrumentFIGI(ctx, ti, args[3])
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Тикер не найден(%v)", err))
+			return
+		}
+	}
+	if err := bot.db.AddCorporateAction(chatID, action); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка записи корпоративного действия(%v)", err))
+		return
+	}
+	bot.sendText(chatID, "Принято", false)
+}
+
+// instrumentFIGI accepts FIGI as is, since instruments that were replaced can't be found by ticker anymore.
+func instrumentFIGI(ctx context.Context, ti *tinkoffinvest.TinkoffInvest, arg string) (string, error) {
+	arg = strings.ToUpper(arg)
+	if strings.HasPrefix(arg, "BBG") && len(arg) == 12 {
+		return arg, nil
+	}
+	instrument, err := ti.InstrumentByTicker(ctx, arg)
+	if err != nil {
+		return "", err
+	}
+	if instrument.FIGI == "" {
+		return "", errors.Errorf("unknown ticker %s", arg)
+	}
+	return instrument.FIGI, nil
+}
+
+// parseRatio parses split ratio given either as a number or as "new:old".
+func parseRatio(arg string) (float64, error) {
+	parts := strings.SplitN(arg, ":", 2)
+	ratio, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid ratio")
+	}
+	if len(parts) == 2 {
+		old, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || old == 0 {
+			return 0, errors.New("invalid ratio")
+		}
+		ratio /= old
+	}
+	if ratio <= 0 {
+		return 0, errors.New("invalid ratio")
+	}
+	return ratio, nil
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+const forecastMonths = 12
+
+func (bot *Bot) handleDividends(ctx context.Context, chatID int64, args []string) {
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		data, err := ti.PortfolioData(ctx, acc.ID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		data.FaceValues, err = ti.FaceValues(ctx, data)
+		if err != nil {
+			// coupons are projected without amortization then
+			bot.log.Error().Err(err).Int64("chatID", chatID).Msg("failed to get face values")
+		}
+		forecast := tinkoffinvest.ForecastIncome(data, forecastMonths)
+		if len(forecast) == 0 {
+			bot.sendText(chatID, string(acc.Type)+":\nНет истории выплат по текущим позициям", false)
+			continue
+		}
+		msg := string(acc.Type) + ": ожидаемые выплаты на 12 месяцев\n" + tinkoffinvest.IncomeForecastSummary(forecast)
+		monthly := tinkoffinvest.MonthlyIncome(forecast, data.Time.In(loc), forecastMonths+1)
+		for _, currency := range tinkoffinvest.Currencies {
+			if _, ok := monthly[currency]; !ok {
+				continue
+			}
+			var total float64
+			for _, amount := range monthly[currency] {
+				total += amount
+			}
+			msg += fmt.Sprintf("Итого %s: %s%.2f\n", currency, currency.Sign(), total)
+		}
+		bot.sendText(chatID, "```\n"+msg+"```", true)
+
+		for _, currency := range tinkoffinvest.Currencies {
+			amounts, ok := monthly[currency]
+			if !ok {
+				continue
+			}
+			title := fmt.Sprintf("%s %s", acc.Type, currency)
+			fi, err := incomeChart(title, data.Time.In(loc), amounts)
+			if err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка генерации графика (%v)", err))
+				return
+			}
+			_, _ = bot.tg.Send(
+				tgbotapi.NewPhotoUpload(
+					chatID, tgbotapi.FileReader{Name: title, Reader: fi, Size: -1}),
+			)
+		}
+	}
+}
+
+// incomeChart renders a bar per month starting with the month of from.
+func incomeChart(title string, from time.Time, amounts []float64) (io.Reader, error) {
+	plot.DefaultFont = "Helvetica"
+	p, err := plot.New()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new plot")
+	}
+	p.Title.Text = title
+	p.Y.Tick.Marker = plot.DefaultTicks{}
+	p.Add(plotter.NewGrid())
+
+	bars, err := plotter.NewBarChart(plotter.Values(amounts), vg.Points(16))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create bar chart")
+	}
+	bars.LineStyle.Width = vg.Length(0)
+	bars.Color = plotter.DefaultLineStyle.Color
+	p.Add(bars)
+
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	labels := make([]string, len(amounts))
+	for i := range labels {
+		labels[i] = start.AddDate(0, i, 0).Format("01/06")
+	}
+	p.NominalX(labels...)
+
+	img := vgimg.New(387, 258)
+	p.Draw(draw.New(img))
+	png := vgimg.PngCanvas{Canvas: img}
+	r, w := io.Pipe()
+	go func(w *io.PipeWriter) {
+		_, _ = png.WriteTo(w)
+		w.Close()
+	}(w)
+
+	return r, nil
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"io"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+func (bot *Bot) handleEquity(ctx context.Context, chatID int64, args []string) {
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	label := "все время"
+	var from time.Time
+	if len(args) > 0 && periodRe.MatchString(args[0]) {
+		_, periods, err := parsePeriod(args[0])
+		if err != nil || len(periods) == 0 {
+			bot.sendError(chatID, fmt.Sprintf("Неверно задан период(%v)", err))
+			return
+		}
+		label = args[0]
+		from = periods[0].from
+		args = args[1:]
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		data, err := ti.PortfolioData(ctx, acc.ID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		prices, err := ti.PriceHistory(ctx, data.Operations, data.Time)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения истории цен(%v)", err))
+			return
+		}
+		curves := tinkoffinvest.EquityCurve(data.Operations, data.Instruments, prices, data.Time)
+		for _, currency := range tinkoffinvest.Currencies {
+			curve := make([]tinkoffinvest.EquityPoint, 0, len(curves[currency]))
+			for _, point := range curves[currency] {
+				if !point.Date.Before(from) {
+					curve = append(curve, point)
+				}
+			}
+			if len(curve) < 2 {
+				continue
+			}
+			title := fmt.Sprintf("%s %s (%s)", acc.Type, currency, label)
+			fi, err := equityChart(title, curve)
+			if err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка генерации графика (%v)", err))
+				return
+			}
+			_, _ = bot.tg.Send(
+				tgbotapi.NewPhotoUpload(
+					chatID, tgbotapi.FileReader{Name: title, Reader: fi, Size: -1}),
+			)
+		}
+	}
+}
+
+func equityChart(title string, curve []tinkoffinvest.EquityPoint) (io.Reader, error) {
+	plot.DefaultFont = "Helvetica"
+	p, err := plot.New()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new plot")
+	}
+	p.Title.Text = title
+	p.X.Tick.Marker = plot.TimeTicks{
+		Format: "2006-01-02",
+		Time: func(t float64) time.Time {
+			return time.Unix(int64(t), 0).In(loc)
+		},
+	}
+	p.Y.Tick.Marker = plot.DefaultTicks{}
+	p.Add(plotter.NewGrid())
+
+	values := make(plotter.XYs, 0, len(curve))
+	deposits := make(plotter.XYs, 0)
+	withdrawals := make(plotter.XYs, 0)
+	for _, point := range curve {
+		xy := plotter.XY{X: float64(point.Date.Unix()), Y: point.Value}
+		values = append(values, xy)
+		switch {
+		case point.Flow > 0:
+			deposits = append(deposits, xy)
+		case point.Flow < 0:
+			withdrawals = append(withdrawals, xy)
+		}
+	}
+	line, err := plotter.NewLine(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create line")
+	}
+	line.LineStyle.Width = vg.Length(1)
+	p.Add(line)
+
+	for _, flows := range []struct {
+		name  string
+		xys   plotter.XYs
+		color color.Color
+		shape draw.GlyphDrawer
+	}{
+		{"пополнения", deposits, color.RGBA{R: 64, G: 160, B: 64, A: 255}, draw.TriangleGlyph{}},
+		{"выводы", withdrawals, color.RGBA{R: 224, G: 64, B: 64, A: 255}, draw.PyramidGlyph{}},
+	} {
+		if len(flows.xys) == 0 {
+			continue
+		}
+		scatter, err := plotter.NewScatter(flows.xys)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create scatter")
+		}
+		scatter.GlyphStyle.Color = flows.color
+		scatter.GlyphStyle.Shape = flows.shape
+		scatter.GlyphStyle.Radius = vg.Points(3)
+		p.Add(scatter)
+		p.Legend.Add(flows.name, scatter)
+	}
+	p.Legend.Top = true
+	p.Legend.Left = true
+
+	img := vgimg.New(387, 258)
+	p.Draw(draw.New(img))
+	png := vgimg.PngCanvas{Canvas: img}
+	r, w := io.Pipe()
+	go func(w *io.PipeWriter) {
+		_, _ = png.WriteTo(w)
+		w.Close()
+	}(w)
+
+	return r, nil
+}
@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+var exportFormats = map[string]func(tinkoffinvest.Portfolio, io.Writer) error{
+	"csv":  tinkoffinvest.Portfolio.WriteCSV,
+	"json": tinkoffinvest.Portfolio.WriteJSON,
+}
+
+// handleExport sends the full portfolio report as documents, both CSV and JSON unless a format is given.
+func (bot *Bot) handleExport(ctx context.Context, chatID int64, args []string) {
+	formats := []string{"csv", "json"}
+	if len(args) > 0 {
+		if _, ok := exportFormats[args[0]]; ok {
+			formats = args[:1]
+			args = args[1:]
+		}
+	}
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		portfolio, err := ti.Portfolio(ctx, acc.ID, bot.portfolioOptions(chatID))
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		for _, format := range formats {
+			var buf bytes.Buffer
+			if err := exportFormats[format](portfolio, &buf); err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка формирования файла(%v)", err))
+				return
+			}
+			bot.sendDocument(chatID, fmt.Sprintf("portfolio-%s.%s", acc.ID, format), buf.Bytes())
+		}
+	}
+}
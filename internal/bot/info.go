@@ -30,9 +30,10 @@ const (
 )
 
 type dataCache struct {
-	stocks sync.Map
-	bonds  sync.Map
-	etfs   sync.Map
+	stocks     sync.Map
+	bonds      sync.Map
+	etfs       sync.Map
+	currencies sync.Map
 }
 
 type instrumentType string
@@ -99,6 +100,26 @@ func (d *dataCache) get(query string, exact bool) (instrument sdk.Instrument, in
 	return
 }
 
+// Instruments returns the cached catalog for portfolio calculations.
+func (d *dataCache) Instruments(ctx context.Context) (tinkoffinvest.Instruments, error) {
+	list := func(m *sync.Map) []sdk.Instrument {
+		items := make([]sdk.Instrument, 0)
+		m.Range(func(key, val interface{}) bool {
+			if item, ok := val.(sdk.Instrument); ok {
+				items = append(items, item)
+			}
+			return true
+		})
+		return items
+	}
+	return tinkoffinvest.Instruments{
+		Stocks:     list(&d.stocks),
+		Bonds:      list(&d.bonds),
+		ETFs:       list(&d.etfs),
+		Currencies: list(&d.currencies),
+	}, nil
+}
+
 func (bot *Bot) dataCacheWorker() {
 	ticker := time.NewTicker(time.Hour)
 	defer ticker.Stop()
@@ -126,6 +147,13 @@ func (bot *Bot) dataCacheWorker() {
 		for _, item := range etfs {
 			bot.dataCache.etfs.Store(item.Ticker, item)
 		}
+		currencies, err := ti.RestClient.Currencies(ctx)
+		if err != nil {
+			bot.log.Error().Err(err).Msg("failed to get currencies while refreshing dataCache")
+		}
+		for _, item := range currencies {
+			bot.dataCache.currencies.Store(item.Ticker, item)
+		}
 		cancel()
 	}
 }
@@ -201,84 +229,12 @@ ISIN: %s
 	if len(args) > 1 {
 		periodArg = args[1]
 	}
-	interval := sdk.CandleInterval1Day
-	periods := make([]Period, 0)
 	if periodRe.MatchString(periodArg) {
 		label = periodArg
-		switch periodArg {
-		case "1mb":
-			interval = sdk.CandleInterval1Min
-			periods = []Period{newPeriod(40, time.Now())}
-		case "2mb":
-			interval = sdk.CandleInterval2Min
-			periods = []Period{newPeriod(hour, time.Now())}
-		case "3mb":
-			interval = sdk.CandleInterval3Min
-			periods = []Period{newPeriod(2*hour, time.Now())}
-		case "5mb":
-			interval = sdk.CandleInterval5Min
-			periods = []Period{newPeriod(4*hour, time.Now())}
-		case "10mb":
-			interval = sdk.CandleInterval10Min
-			periods = []Period{newPeriod(8*hour, time.Now())}
-		case "15mb":
-			interval = sdk.CandleInterval15Min
-			periods = []Period{newPeriod(15*hour, time.Now())}
-		case "30mb":
-			interval = sdk.CandleInterval30Min
-			periods = []Period{newPeriod(23*hour, time.Now())}
-		case "1hb":
-			interval = sdk.CandleInterval1Hour
-			periods = []Period{newPeriod(7*day-hour, time.Now())}
-		case "1db":
-			interval = sdk.CandleInterval1Day
-			periods = []Period{newPeriod(60*day, time.Now())}
-		case "1wb":
-			interval = sdk.CandleInterval1Week
-			periods = []Period{newPeriod(50*week, time.Now())}
-		case "1mob":
-			interval = sdk.CandleInterval1Month
-			periods = []Period{newPeriod(50*month, time.Now())}
-		default:
-			rawPeriod, err := duration.Parse(periodArg, "h")
-			period := int64(rawPeriod / 60000)
-			if period < 5 {
-				bot.sendError(chatID, fmt.Sprintf("Неверно задан период(%v)", err))
-				return
-			}
-			switch {
-			case period >= 10*year:
-				interval = sdk.CandleInterval1Month
-				periods = splitPeriod(period, 10*year)
-			case period >= 2*year:
-				interval = sdk.CandleInterval1Month
-			case period >= 140*day:
-				interval = sdk.CandleInterval1Week
-			case period > 40*day:
-				interval = sdk.CandleInterval1Day
-			case period > 7*day:
-				interval = sdk.CandleInterval1Hour
-				periods = splitPeriod(period, 7*day)
-			case period >= 30*hour:
-				interval = sdk.CandleInterval1Hour
-			case period >= 15*hour:
-				interval = sdk.CandleInterval30Min
-			case period >= 8*hour:
-				interval = sdk.CandleInterval15Min
-			case period >= 4*hour:
-				interval = sdk.CandleInterval10Min
-			case period >= 2*hour:
-				interval = sdk.CandleInterval5Min
-			case period >= hour:
-				interval = sdk.CandleInterval3Min
-			case period >= 40:
-				interval = sdk.CandleInterval2Min
-			default:
-				interval = sdk.CandleInterval1Min
-			}
-			if len(periods) == 0 {
-				periods = []Period{newPeriod(period, time.Now())}
-			}
+		interval, periods, err := parsePeriod(periodArg)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Неверно задан период(%v)", err))
+			return
 		}
 		allCandles := make([]sdk.Candle, 0)
 		for _, period := range periods {
@@ -306,6 +262,91 @@ ISIN: %s
 	}
 }
 
+// parsePeriod interprets a period argument as either a bar size or a duration to look back,
+// returning the candle interval and the request periods to cover it.
+func parsePeriod(periodArg string) (sdk.CandleInterval, []Period, error) {
+	interval := sdk.CandleInterval1Day
+	periods := make([]Period, 0)
+	switch periodArg {
+	case "1mb":
+		interval = sdk.CandleInterval1Min
+		periods = []Period{newPeriod(40, time.Now())}
+	case "2mb":
+		interval = sdk.CandleInterval2Min
+		periods = []Period{newPeriod(hour, time.Now())}
+	case "3mb":
+		interval = sdk.CandleInterval3Min
+		periods = []Period{newPeriod(2*hour, time.Now())}
+	case "5mb":
+		interval = sdk.CandleInterval5Min
+		periods = []Period{newPeriod(4*hour, time.Now())}
+	case "10mb":
+		interval = sdk.CandleInterval10Min
+		periods = []Period{newPeriod(8*hour, time.Now())}
+	case "15mb":
+		interval = sdk.CandleInterval15Min
+		periods = []Period{newPeriod(15*hour, time.Now())}
+	case "30mb":
+		interval = sdk.CandleInterval30Min
+		periods = []Period{newPeriod(23*hour, time.Now())}
+	case "1hb":
+		interval = sdk.CandleInterval1Hour
+		periods = []Period{newPeriod(7*day-hour, time.Now())}
+	case "1db":
+		interval = sdk.CandleInterval1Day
+		periods = []Period{newPeriod(60*day, time.Now())}
+	case "1wb":
+		interval = sdk.CandleInterval1Week
+		periods = []Period{newPeriod(50*week, time.Now())}
+	case "1mob":
+		interval = sdk.CandleInterval1Month
+		periods = []Period{newPeriod(50*month, time.Now())}
+	default:
+		rawPeriod, err := duration.Parse(periodArg, "h")
+		if err != nil {
+			return interval, nil, err
+		}
+		period := int64(rawPeriod / 60000)
+		if period < 5 {
+			return interval, nil, errors.Errorf("период %s слишком мал", periodArg)
+		}
+		switch {
+		case period >= 10*year:
+			interval = sdk.CandleInterval1Month
+			periods = splitPeriod(period, 10*year)
+		case period >= 2*year:
+			interval = sdk.CandleInterval1Month
+		case period >= 140*day:
+			interval = sdk.CandleInterval1Week
+		case period > 40*day:
+			interval = sdk.CandleInterval1Day
+		case period > 7*day:
+			interval = sdk.CandleInterval1Hour
+			periods = splitPeriod(period, 7*day)
+		case period >= 30*hour:
+			interval = sdk.CandleInterval1Hour
+		case period >= 15*hour:
+			interval = sdk.CandleInterval30Min
+		case period >= 8*hour:
+			interval = sdk.CandleInterval15Min
+		case period >= 4*hour:
+			interval = sdk.CandleInterval10Min
+		case period >= 2*hour:
+			interval = sdk.CandleInterval5Min
+		case period >= hour:
+			interval = sdk.CandleInterval3Min
+		case period >= 40:
+			interval = sdk.CandleInterval2Min
+		default:
+			interval = sdk.CandleInterval1Min
+		}
+		if len(periods) == 0 {
+			periods = []Period{newPeriod(period, time.Now())}
+		}
+	}
+	return interval, periods, nil
+}
+
 type Period struct {
 	from time.Time
 	to   time.Time
@@ -23,19 +23,19 @@ func (bot *Bot) handleApiKey(ctx context.Context, chatID int64, args []string) {
 	bot.sendText(chatID, "Принято", false)
 }
 
-func (bot *Bot) handlePortfolioSummary(ctx context.Context, chatID int64) {
+func (bot *Bot) handlePortfolioSummary(ctx context.Context, chatID int64, args []string) {
 	apiKey := bot.fetchApiKey(chatID, true)
 	if apiKey == "" {
 		return
 	}
-	ti := tinkoffinvest.NewAPI(apiKey)
-	accounts, err := ti.RestClient.Accounts(ctx)
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
 	if err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
 		return
 	}
 	for _, acc := range accounts {
-		portfolio, err := ti.Portfolio(ctx, acc.ID)
+		portfolio, err := ti.Portfolio(ctx, acc.ID, bot.portfolioOptions(chatID))
 		if err != nil {
 			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
 			return
@@ -45,19 +45,19 @@ func (bot *Bot) handlePortfolioSummary(ctx context.Context, chatID int64) {
 	}
 }
 
-func (bot *Bot) handlePortfolioDetails(ctx context.Context, chatID int64) {
+func (bot *Bot) handlePortfolioDetails(ctx context.Context, chatID int64, args []string) {
 	apiKey := bot.fetchApiKey(chatID, true)
 	if apiKey == "" {
 		return
 	}
-	ti := tinkoffinvest.NewAPI(apiKey)
-	accounts, err := ti.RestClient.Accounts(ctx)
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
 	if err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
 		return
 	}
 	for _, acc := range accounts {
-		portfolio, err := ti.Portfolio(ctx, acc.ID)
+		portfolio, err := ti.Portfolio(ctx, acc.ID, bot.portfolioOptions(chatID))
 		if err != nil {
 			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
 			return
@@ -74,8 +74,58 @@ func (bot *Bot) handlePortfolioDetails(ctx context.Context, chatID int64) {
 			}
 			msg += details
 		}
+		if warnings := portfolio.WarningsSummary(); warnings != "" {
+			warnings = "\n" + markDownEscape.Replace(warnings)
+			if len(msg)+len(warnings) >= 4096 {
+				bot.sendText(chatID, msg, true)
+				msg = ""
+			}
+			msg += warnings
+		}
 		if msg != "" {
 			bot.sendText(chatID, msg, true)
 		}
 	}
 }
+
+func (bot *Bot) handlePortfolioReturns(ctx context.Context, chatID int64, args []string) {
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		data, err := ti.PortfolioData(ctx, acc.ID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		data.Prices, err = ti.PriceHistory(ctx, data.Operations, data.Time)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения истории цен(%v)", err))
+			return
+		}
+		portfolio := tinkoffinvest.BuildPortfolio(data, bot.portfolioOptions(chatID))
+		summary := portfolio.ReturnsSummary()
+		if summary == "" {
+			summary = "Нет данных о пополнениях счета"
+		}
+		bot.sendText(chatID, string(acc.Type)+":\n"+markDownEscape.Replace(summary), true)
+	}
+}
+
+// portfolioAPI returns API client that keeps downloaded operations of the chat in the database
+// and resolves instruments from dataCache.
+func (bot *Bot) portfolioAPI(chatID int64, apiKey string) *tinkoffinvest.TinkoffInvest {
+	ti := tinkoffinvest.NewAPI(apiKey)
+	if bot.db.IsSet() {
+		ti.OperationsStore = bot.db.OperationsStore(chatID)
+	}
+	ti.InstrumentsCache = &bot.dataCache
+	return ti
+}
@@ -72,9 +72,7 @@ func (bot *Bot) handleWatch(ctx context.Context, chatID int64, args []string) {
 		bot.sendError(chatID, fmt.Sprintf("Не удалось добавить отслеживание(%v)", err))
 		return
 	}
-	if client := bot.StreamingWorker(chatID); client != nil {
-		client.SubscribeCandles(pw.FIGI, chatID)
-	}
+	bot.watchCandles(chatID, pw.FIGI)
 	bot.sendText(chatID, "Принято", false)
 }
 
@@ -127,17 +125,11 @@ func (bot *Bot) handleWatchDelete(ctx context.Context, chatID int64, args []stri
 		bot.sendError(chatID, fmt.Sprintf("Ошибка удаления отслеживания(%v)", err))
 		return
 	}
-	priceWatchers, err := bot.db.PriceWatchListByFIGI(chatID, instrument.FIGI)
-	if err == nil && len(priceWatchers) == 0 {
-		client := bot.StreamingWorker(chatID)
-		if client != nil {
-			client.UnsubscribeCandles(instrument.FIGI, chatID)
-		}
-	}
+	bot.unwatchCandles(chatID, instrument.FIGI)
 	bot.sendText(chatID, "Удаление успешно", false)
 }
 
-func (bot *Bot) handleWatchList(ctx context.Context, chatID int64) {
+func (bot *Bot) handleWatchList(ctx context.Context, chatID int64, args []string) {
 	items, err := bot.db.PriceWatchList(chatID)
 	if err != nil {
 		bot.sendError(chatID, fmt.Sprintf("Ошибка получения списка отслеживания(%v)", err))
@@ -147,7 +139,16 @@ func (bot *Bot) handleWatchList(ctx context.Context, chatID int64) {
 	var portfolio map[string]sdk.PositionBalance
 	if apiKey != "" {
 		ti := tinkoffinvest.NewAPI(apiKey)
-		portfolio, err = ti.PortfolioPositions(context.Background(), bot.mainAccountID(chatID))
+		accountID := bot.mainAccountID(chatID)
+		if len(args) > 0 {
+			accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+			if err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+				return
+			}
+			accountID = accounts[0].ID
+		}
+		portfolio, err = ti.PortfolioPositions(context.Background(), accountID)
 		if err != nil {
 			bot.log.Error().Err(err).Int64("chatID", chatID).Msg("failed to get portfolio")
 		}
@@ -183,10 +184,17 @@ func tickerURL(ticker string, t instrumentType) string {
 	return fmt.Sprintf("https://www.tinkoff.ru/invest/%s/%s/", t, ticker)
 }
 
+// mainAccountID returns the default account chosen with /accounts, falling back to the broker account.
 func (bot *Bot) mainAccountID(chatID int64) string {
 	if accID, ok := bot.accountCache.Load(chatID); ok {
 		return accID.(string)
 	}
+	if bot.db.IsSet() {
+		if accID, err := bot.db.DefaultAccount(chatID); err == nil && accID != "" {
+			bot.accountCache.Store(chatID, accID)
+			return accID
+		}
+	}
 	apiKey := bot.fetchApiKey(chatID, false)
 	if apiKey == "" {
 		return ""
@@ -204,12 +212,28 @@ func (bot *Bot) mainAccountID(chatID int64) string {
 	return ""
 }
 
-func (bot *Bot) StreamingWorker(chatID int64) *tinkoffinvest.StreamingClient {
-	bot.streamingClientsMu.Lock()
-	defer bot.streamingClientsMu.Unlock()
-	if client, ok := bot.streamingClients[chatID]; ok {
-		return client
+// StreamingWorker subscribes price watchers of a chat to candle streams.
+func (bot *Bot) StreamingWorker(chatID int64) {
+	allPriceWatchers, err := bot.db.PriceWatchList(chatID)
+	if err != nil {
+		bot.log.Error().Int64("chatID", chatID).Msg("failed to get price watchers")
+		return
 	}
+	for _, pw := range allPriceWatchers {
+		bot.watchCandles(chatID, pw.FIGI)
+	}
+}
+
+// candleWatch is a candle subscription of a chat, cancel is nil while it is being set up.
+type candleWatch struct {
+	cancel func()
+	// generation counts watchCandles calls, so unwatchCandles can tell a watcher was added while it listed them
+	generation uint64
+}
+
+// watchCandles starts processing candles of figi for price watchers of a chat. Chats without a key of their own
+// share connections of the default key, every chat gets each candle of its FIGIs.
+func (bot *Bot) watchCandles(chatID int64, figi string) {
 	isPrivateAccount := true
 	apiKey := bot.fetchApiKey(chatID, false)
 	if apiKey == "" {
@@ -218,98 +242,140 @@ func (bot *Bot) StreamingWorker(chatID int64) *tinkoffinvest.StreamingClient {
 	}
 	if apiKey == "" {
 		bot.log.Error().Int64("chatID", chatID).Msg("failed to get api key")
-		return nil
+		return
 	}
-	var client *tinkoffinvest.StreamingClient
-	if !isPrivateAccount {
-		client = bot.streamingClients[0]
+	bot.candleWatchesMu.Lock()
+	if watch, ok := bot.candleWatches[chatID][figi]; ok {
+		watch.generation++
+		bot.candleWatchesMu.Unlock()
+		return
 	}
-	if client == nil {
-		client = tinkoffinvest.NewStreamingClient(
-			apiKey, bot.log.With().Str("module", "streaming").Int64("chatID", chatID).Bool("private", isPrivateAccount).Logger(),
-		)
-		if !isPrivateAccount {
-			bot.streamingClients[0] = client
+	if bot.candleWatches[chatID] == nil {
+		bot.candleWatches[chatID] = make(map[string]*candleWatch)
+	}
+	watch := &candleWatch{}
+	bot.candleWatches[chatID][figi] = watch
+	bot.candleWatchesMu.Unlock()
 
+	// the pool is called unlocked so a slow connection doesn't hold up other chats
+	events, cancel := bot.streaming.Subscribe(apiKey, figi, tinkoffinvest.DefaultCandleInterval)
+	bot.candleWatchesMu.Lock()
+	current := bot.candleWatches[chatID][figi] == watch
+	if current {
+		watch.cancel = cancel
+	}
+	bot.candleWatchesMu.Unlock()
+	if !current {
+		// unwatched while subscribing
+		cancel()
+		return
+	}
+	go func() {
+		ti := tinkoffinvest.NewAPI(apiKey)
+		for event := range events {
+			bot.processCandle(chatID, isPrivateAccount, ti, event)
 		}
+	}()
+}
+
+// unwatchCandles stops processing candles of figi for a chat once it has no price watchers of figi left.
+// The watchers are listed outside of candleWatchesMu, a watcher added meanwhile calls watchCandles,
+// which bumps the generation and keeps the stream.
+func (bot *Bot) unwatchCandles(chatID int64, figi string) {
+	bot.candleWatchesMu.Lock()
+	watch, ok := bot.candleWatches[chatID][figi]
+	var generation uint64
+	if ok {
+		generation = watch.generation
+	}
+	bot.candleWatchesMu.Unlock()
+	if !ok {
+		return
 	}
-	if isPrivateAccount {
-		bot.streamingClients[chatID] = client
+	priceWatchers, err := bot.db.PriceWatchListByFIGI(chatID, figi)
+	if err != nil {
+		bot.log.Error().Err(err).Int64("chatID", chatID).Str("figi", figi).Msg("failed to get price watch list")
+		return
 	}
-	allPriceWatchers, err := bot.db.PriceWatchList(chatID)
+	if len(priceWatchers) > 0 {
+		return
+	}
+	bot.candleWatchesMu.Lock()
+	if bot.candleWatches[chatID][figi] != watch || watch.generation != generation {
+		bot.candleWatchesMu.Unlock()
+		return
+	}
+	delete(bot.candleWatches[chatID], figi)
+	cancel := watch.cancel
+	bot.candleWatchesMu.Unlock()
+	// a watch still subscribing has no cancel yet and cancels itself once it sees it was removed
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (bot *Bot) processCandle(chatID int64, isPrivateAccount bool, ti *tinkoffinvest.TinkoffInvest, event tinkoffinvest.CandleEvent) {
+	items, err := bot.db.PriceWatchListByFIGI(chatID, event.FIGI)
 	if err != nil {
-		bot.log.Error().Int64("chatID", chatID).Msg("failed to get price watchers")
-	} else {
-		for _, pw := range allPriceWatchers {
-			client.SubscribeCandles(pw.FIGI, chatID)
-		}
+		bot.log.Error().Int64("chatID", chatID).Interface("event", event).Msg("failed to get price watch list")
+		return
 	}
-	go func() {
-		ti := tinkoffinvest.NewAPI(apiKey)
-		for event := range client.Events() {
-			switch eventData := event.Data.(type) {
-			case sdk.CandleEvent:
-				items, err := bot.db.PriceWatchListByFIGI(chatID, eventData.Candle.FIGI)
-				if err != nil {
-					bot.log.Error().Int64("chatID", chatID).Interface("event", event).Msg("failed to get price watch list")
-					continue
-				}
-				for _, pw := range items {
-					if pw.CurrentValue != eventData.Candle.ClosePrice {
-						err = bot.db.PriceWatchSetCurrentValue(pw.FIGI, eventData.Candle.ClosePrice)
-						if err != nil {
-							bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to set current value")
-						}
-						pw.CurrentValue = eventData.Candle.ClosePrice
+	left := len(items)
+	for _, pw := range items {
+		if pw.CurrentValue != event.ClosePrice {
+			err = bot.db.PriceWatchSetCurrentValue(pw.FIGI, event.ClosePrice)
+			if err != nil {
+				bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to set current value")
+			}
+			pw.CurrentValue = event.ClosePrice
+		}
+		if pw.IsPc {
+			pc := pw.Pc()
+			if math.Abs(pc) >= pw.Threshold {
+				var portfolio map[string]sdk.PositionBalance
+				if isPrivateAccount {
+					portfolio, err = ti.PortfolioPositions(context.Background(), bot.mainAccountID(chatID))
+					if err != nil {
+						bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to get portfolio")
 					}
-					if pw.IsPc {
-						pc := pw.Pc()
-						if math.Abs(pc) >= pw.Threshold {
-							var portfolio map[string]sdk.PositionBalance
-							if isPrivateAccount {
-								portfolio, err = ti.PortfolioPositions(context.Background(), bot.mainAccountID(chatID))
-								if err != nil {
-									bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to get portfolio")
-								}
-							}
-							if portfolio != nil {
-								if position, ok := portfolio[pw.FIGI]; ok && position.AveragePositionPrice.Value > 0 {
-									pw.PortfolioGain = pw.CurrentValue*100/position.AveragePositionPrice.Value - 100
-								}
-							}
-							err = bot.db.PriceWatchSetLastValue(pw.ID, pw.CurrentValue)
-							if err != nil {
-								bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to set last value")
-							}
-							if _, t, ok := bot.dataCache.get(pw.Ticker, true); ok {
-								pw.TickerURL = fmt.Sprintf("[$%s](%s)", pw.Ticker, tickerURL(pw.Ticker, t))
-							}
-							bot.log.Info().
-								Int64("chatID", pw.ChatID).Interface("event", event).Str("msg", pw.String()).Msg("sending price watch alarm")
-							bot.sendText(pw.ChatID,
-								pw.String(),
-								true,
-							)
-						}
-					} else if (pw.Threshold > pw.LastValue && pw.CurrentValue >= pw.Threshold) ||
-						(pw.Threshold < pw.LastValue && pw.CurrentValue <= pw.Threshold) {
-						err = bot.db.PriceWatchDeleteByID(pw.ID)
-						if err != nil {
-							bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to delete fixed price watcher")
-						}
-						bot.log.Info().
-							Int64("chatID", pw.ChatID).Interface("event", event).Str("msg", pw.String()).Msg("sending price watch alarm")
-
-						bot.sendText(pw.ChatID, pw.String(), true)
+				}
+				if portfolio != nil {
+					if position, ok := portfolio[pw.FIGI]; ok && position.AveragePositionPrice.Value > 0 {
+						pw.PortfolioGain = pw.CurrentValue*100/position.AveragePositionPrice.Value - 100
 					}
 				}
-			default:
-				bot.log.Error().Interface("event", event).Msg("unsupported event type")
-				continue
+				err = bot.db.PriceWatchSetLastValue(pw.ID, pw.CurrentValue)
+				if err != nil {
+					bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to set last value")
+				}
+				if _, t, ok := bot.dataCache.get(pw.Ticker, true); ok {
+					pw.TickerURL = fmt.Sprintf("[$%s](%s)", pw.Ticker, tickerURL(pw.Ticker, t))
+				}
+				bot.log.Info().
+					Int64("chatID", pw.ChatID).Interface("event", event).Str("msg", pw.String()).Msg("sending price watch alarm")
+				bot.sendText(pw.ChatID,
+					pw.String(),
+					true,
+				)
+			}
+		} else if (pw.Threshold > pw.LastValue && pw.CurrentValue >= pw.Threshold) ||
+			(pw.Threshold < pw.LastValue && pw.CurrentValue <= pw.Threshold) {
+			err = bot.db.PriceWatchDeleteByID(pw.ID)
+			if err != nil {
+				bot.log.Error().Interface("pw", pw).Interface("event", event).Msg("failed to delete fixed price watcher")
+			} else {
+				left--
 			}
+			bot.log.Info().
+				Int64("chatID", pw.ChatID).Interface("event", event).Str("msg", pw.String()).Msg("sending price watch alarm")
+
+			bot.sendText(pw.ChatID, pw.String(), true)
 		}
-	}()
-	return client
+	}
+	if left == 0 {
+		// the last watcher fired unless one was added meanwhile, unwatchCandles checks again
+		bot.unwatchCandles(chatID, event.FIGI)
+	}
 }
 
 func (bot *Bot) priceWatcherDailyWorker() {
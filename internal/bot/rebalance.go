@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+// handleRebalance manages target weights and proposes trades reaching them with an optional amount of cash.
+func (bot *Bot) handleRebalance(ctx context.Context, chatID int64, args []string) {
+	if !bot.db.IsSet() {
+		bot.sendError(chatID, "Ребалансировка недоступна без базы данных")
+		return
+	}
+	if len(args) > 0 {
+		switch args[0] {
+		case "set":
+			bot.handleRebalanceSet(chatID, args[1:])
+			return
+		case "delete":
+			if len(args) < 2 {
+				bot.sendError(chatID, "Не указан тикер. Пример: /rebalance delete AAPL")
+				return
+			}
+			if err := bot.db.DeleteTargetWeight(chatID, targetName(args[1])); err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка удаления веса(%v)", err))
+				return
+			}
+			bot.sendText(chatID, "Удаление успешно", false)
+			return
+		}
+	}
+	targets, err := bot.db.TargetWeights(chatID)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения целевых весов(%v)", err))
+		return
+	}
+	if len(targets) == 0 {
+		bot.sendText(
+			chatID,
+			"Целевые веса не заданы\\. Примеры:\n*/rebalance set AAPL 10*\n*/rebalance set bonds 40*\n*/rebalance 50000* \\- план с учетом ₽50000 для покупок",
+			true,
+		)
+		return
+	}
+	var cash float64
+	if len(args) > 0 {
+		cash, err = strconv.ParseFloat(strings.ReplaceAll(args[0], ",", "."), 64)
+		if err != nil || cash < 0 {
+			bot.sendError(chatID, "Не удалось интерпретировать сумму. Пример: /rebalance 50000")
+			return
+		}
+		args = args[1:]
+	}
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	msg := "Целевые веса:"
+	for _, target := range targets {
+		msg += fmt.Sprintf(" %s %.2f%%", target.Target, target.Weight)
+	}
+	msg += "\n"
+	for _, acc := range accounts {
+		plan, err := ti.Rebalance(ctx, acc.ID, targets, cash)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка расчета ребалансировки(%v)", err))
+			return
+		}
+		bot.sendText(chatID, "```\n"+string(acc.Type)+":\n"+msg+plan.Summary()+"```", true)
+	}
+}
+
+func (bot *Bot) handleRebalanceSet(chatID int64, args []string) {
+	if len(args) < 2 {
+		bot.sendError(chatID, "Ошибка: не указан тикер или вес. Пример: /rebalance set AAPL 10")
+		return
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(args[1], ",", "."), "%"), 64)
+	if err != nil || weight < 0 || weight > 100 {
+		bot.sendError(chatID, "Не удалось интерпретировать вес. Пример: 12.5")
+		return
+	}
+	target := tinkoffinvest.TargetWeight{Target: targetName(args[0]), Weight: weight}
+	if err := bot.db.SetTargetWeight(chatID, target); err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка записи веса(%v)", err))
+		return
+	}
+	bot.sendText(chatID, "Принято", false)
+}
+
+// targetName keeps asset classes lowercase and tickers uppercase.
+func targetName(arg string) string {
+	if _, ok := tinkoffinvest.AssetClass(arg); ok {
+		return strings.ToLower(arg)
+	}
+	return strings.ToUpper(arg)
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/triamazikamno/tinkoff-invest/internal/duration"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+const (
+	defaultRiskPeriod    = "365d"
+	defaultRiskBenchmark = "FXRL"
+)
+
+// handleRisk reports volatility, drawdown and beta of holdings and of the portfolio at current weights.
+func (bot *Bot) handleRisk(ctx context.Context, chatID int64, args []string) {
+	periodArg := defaultRiskPeriod
+	if len(args) > 0 && periodRe.MatchString(args[0]) {
+		periodArg = args[0]
+		args = args[1:]
+	}
+	rawPeriod, err := duration.Parse(periodArg, "h")
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Неверно задан период(%v)", err))
+		return
+	}
+	period := int64(rawPeriod / 60000)
+	if period < 7*day {
+		bot.sendError(chatID, "Период должен быть не меньше недели")
+		return
+	}
+	benchmarkArg := defaultRiskBenchmark
+	if len(args) > 0 {
+		benchmarkArg = args[0]
+		args = args[1:]
+	}
+
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	to := time.Now()
+	from := to.Add(-time.Duration(period) * time.Minute)
+	benchmarkFIGI, err := instrumentFIGI(ctx, ti, benchmarkArg)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Бенчмарк %s не найден(%v)", benchmarkArg, err))
+		return
+	}
+	benchmark, err := ti.DailyCandles(ctx, benchmarkFIGI, from, to)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения свечей (%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		data, err := ti.PortfolioData(ctx, acc.ID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения информации о портфеле(%v)", err))
+			return
+		}
+		candles := make(map[string][]sdk.Candle)
+		for figi, position := range data.Positions {
+			if position.InstrumentType == sdk.InstrumentTypeCurrency || position.Balance <= 0 {
+				continue
+			}
+			if candles[figi], err = ti.DailyCandles(ctx, figi, from, to); err != nil {
+				bot.sendError(chatID, fmt.Sprintf("Ошибка получения свечей (%v)", err))
+				return
+			}
+		}
+		report := tinkoffinvest.BuildRiskReport(data, candles, benchmarkArg, benchmark)
+		if len(report.Holdings) == 0 {
+			bot.sendText(chatID, string(acc.Type)+":\nПортфель пуст", false)
+			continue
+		}
+		bot.sendText(chatID, "```\n"+string(acc.Type)+" за "+periodArg+":\n"+report.Summary()+"```", true)
+	}
+}
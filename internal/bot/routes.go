@@ -22,7 +22,9 @@ func (bot *Bot) listenUpdates(ch tgbotapi.UpdatesChannel) {
 			chat = update.Message.Chat
 			user = update.Message.From
 		case update.CallbackQuery != nil:
-			command = update.CallbackQuery.Data
+			if fields := strings.Fields(update.CallbackQuery.Data); len(fields) > 0 {
+				command, args = fields[0], fields[1:]
+			}
 			chatID = update.CallbackQuery.Message.Chat.ID
 			_, _ = bot.tg.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data))
 		}
@@ -52,6 +54,8 @@ func (bot *Bot) listenUpdates(ch tgbotapi.UpdatesChannel) {
 			bot.handleHelp(chatID)
 		case "stop":
 			bot.handleStop(chatID)
+		case "status":
+			bot.handleStatus(chatID)
 		case "apikey":
 			bot.handleApiKey(context.Background(), chatID, args)
 		case "gainers", "g":
@@ -63,13 +67,35 @@ func (bot *Bot) listenUpdates(ch tgbotapi.UpdatesChannel) {
 		case "watch", "w":
 			bot.handleWatch(context.Background(), chatID, args)
 		case "watchlist", "wl":
-			bot.handleWatchList(context.Background(), chatID)
+			bot.handleWatchList(context.Background(), chatID, args)
 		case "watchdelete", "wd":
 			bot.handleWatchDelete(context.Background(), chatID, args)
 		case "sum", "summary":
-			bot.handlePortfolioSummary(context.Background(), chatID)
+			bot.handlePortfolioSummary(context.Background(), chatID, args)
 		case "full", "fullreport":
-			bot.handlePortfolioDetails(context.Background(), chatID)
+			bot.handlePortfolioDetails(context.Background(), chatID, args)
+		case "acc", "accounts":
+			bot.handleAccounts(context.Background(), chatID, args)
+		case "tr", "transfer":
+			bot.handleTransfer(context.Background(), chatID, args)
+		case "ca", "corpaction":
+			bot.handleCorporateAction(context.Background(), chatID, args)
+		case "tax", "taxreport":
+			bot.handleTaxReport(context.Background(), chatID, args)
+		case "export":
+			bot.handleExport(context.Background(), chatID, args)
+		case "div", "dividends":
+			bot.handleDividends(context.Background(), chatID, args)
+		case "alloc", "allocation":
+			bot.handleAllocation(context.Background(), chatID, args)
+		case "rb", "rebalance":
+			bot.handleRebalance(context.Background(), chatID, args)
+		case "risk":
+			bot.handleRisk(context.Background(), chatID, args)
+		case "ret", "returns":
+			bot.handlePortfolioReturns(context.Background(), chatID, args)
+		case "eq", "equity":
+			bot.handleEquity(context.Background(), chatID, args)
 		case "i", "info":
 			bot.handleInfo(context.Background(), chatID, args)
 		default:
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+)
+
+// handleStatus shows streaming connection health to admins, other chats get no reply.
+func (bot *Bot) handleStatus(chatID int64) {
+	if _, ok := bot.admins[chatID]; !ok {
+		bot.log.Warn().Int64("chatID", chatID).Msg("status requested by non-admin")
+		return
+	}
+	connections := bot.streaming.Connections()
+	sort.Slice(connections, func(i, j int) bool {
+		iDefault, jDefault := connections[i].APIKey == bot.defaultApiKey, connections[j].APIKey == bot.defaultApiKey
+		if iDefault != jDefault {
+			return iDefault
+		}
+		if connections[i].APIKey != connections[j].APIKey {
+			return connections[i].APIKey < connections[j].APIKey
+		}
+		return connections[i].Shard < connections[j].Shard
+	})
+	msg := fmt.Sprintf("Подключений к потоку: %d\n", len(connections))
+	// API keys are secrets, personal keys are told apart by number only
+	keys := make(map[string]int)
+	for _, conn := range connections {
+		name := fmt.Sprintf("общий ключ, соединение %d", conn.Shard+1)
+		if conn.APIKey != bot.defaultApiKey {
+			if _, ok := keys[conn.APIKey]; !ok {
+				keys[conn.APIKey] = len(keys) + 1
+			}
+			name = fmt.Sprintf("личный ключ %d, соединение %d", keys[conn.APIKey], conn.Shard+1)
+		}
+		msg += fmt.Sprintf(
+			"%s: %s с %s, подписок %d, переподключений %d\n",
+			name, conn.State.State, conn.State.Since.In(loc).Format("2006/01/02 15:04:05"),
+			conn.Subscriptions, conn.State.Reconnects,
+		)
+		if conn.State.LastError != nil {
+			msg += fmt.Sprintf("  последняя ошибка: %v\n", conn.State.LastError)
+		}
+	}
+	bot.sendText(chatID, "```\n"+msg+"```", true)
+}
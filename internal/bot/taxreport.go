@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/triamazikamno/tinkoff-invest/internal/xlsx"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+func (bot *Bot) handleTaxReport(ctx context.Context, chatID int64, args []string) {
+	year := time.Now().In(loc).Year() - 1
+	if len(args) > 0 {
+		var err error
+		year, err = strconv.Atoi(args[0])
+		if err != nil || year < 2000 || year > time.Now().Year() {
+			bot.sendError(chatID, "Неверно задан год. Пример: /taxreport 2020")
+			return
+		}
+		args = args[1:]
+	}
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	ti := bot.portfolioAPI(chatID, apiKey)
+	accounts, err := bot.resolveAccounts(ctx, chatID, ti, args)
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка получения счетов(%v)", err))
+		return
+	}
+	for _, acc := range accounts {
+		report, err := ti.TaxReport(ctx, acc.ID, year, bot.portfolioOptions(chatID))
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка построения налогового отчета(%v)", err))
+			return
+		}
+		name := fmt.Sprintf("tax-%d-%s", year, acc.ID)
+		tables := report.Tables()
+
+		var csv bytes.Buffer
+		if err := report.WriteCSV(&csv); err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка формирования CSV(%v)", err))
+			return
+		}
+		bot.sendDocument(chatID, name+".csv", csv.Bytes())
+
+		var spreadsheet bytes.Buffer
+		if err := xlsx.Write(&spreadsheet, tableSheets(tables)); err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка формирования XLSX(%v)", err))
+			return
+		}
+		bot.sendDocument(chatID, name+".xlsx", spreadsheet.Bytes())
+	}
+}
+
+// tableSheets puts every table on its own sheet with the header in the first row.
+func tableSheets(tables []tinkoffinvest.Table) []xlsx.Sheet {
+	sheets := make([]xlsx.Sheet, 0, len(tables))
+	for _, table := range tables {
+		header := make([]interface{}, len(table.Header))
+		for i, title := range table.Header {
+			header[i] = title
+		}
+		sheets = append(sheets, xlsx.Sheet{
+			Name: table.Name,
+			Rows: append([][]interface{}{header}, table.Rows...),
+		})
+	}
+	return sheets
+}
+
+func (bot *Bot) sendDocument(chatID int64, name string, content []byte) {
+	_, err := bot.tg.Send(tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileBytes{Name: name, Bytes: content}))
+	if err != nil {
+		bot.log.Err(err).Int64("chatID", chatID).Str("name", name).Msg("failed to send telegram document")
+	}
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/triamazikamno/tinkoff-invest/internal/db"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+// handleTransfer sets the purchase price of securities transferred in from another broker.
+func (bot *Bot) handleTransfer(ctx context.Context, chatID int64, args []string) {
+	if !bot.db.IsSet() {
+		bot.sendError(chatID, "Задание цены покупки недоступно без базы данных")
+		return
+	}
+	if len(args) == 0 {
+		items, err := bot.db.TransferPrices(chatID)
+		if err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка получения цен покупки(%v)", err))
+			return
+		}
+		msg := "Пример: */transfer AAPL 123\\.45*\nУдаление: */transfer AAPL \\-*\n"
+		for _, tp := range items {
+			msg += markDownEscape.Replace(fmt.Sprintf("%s (%s): %.4f", tp.Ticker, tp.FIGI, tp.Price)) + "\n"
+		}
+		bot.sendText(chatID, msg, true)
+		return
+	}
+	if len(args) < 2 {
+		bot.sendError(chatID, "Не задана цена покупки. Пример: /transfer AAPL 123.45, удаление: /transfer AAPL -")
+		return
+	}
+	apiKey := bot.fetchApiKey(chatID, true)
+	if apiKey == "" {
+		return
+	}
+	instrument, err := tinkoffinvest.NewAPI(apiKey).InstrumentByTicker(ctx, strings.ToUpper(args[0]))
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Тикер не найден(%v)", err))
+		return
+	}
+	if instrument.FIGI == "" {
+		bot.sendError(chatID, "Тикер не найден")
+		return
+	}
+	if args[1] == "-" {
+		if err := bot.db.DeleteTransferPrice(chatID, instrument.FIGI); err != nil {
+			bot.sendError(chatID, fmt.Sprintf("Ошибка удаления цены покупки(%v)", err))
+			return
+		}
+		bot.sendText(chatID, "Удаление успешно", false)
+		return
+	}
+	price, err := strconv.ParseFloat(strings.ReplaceAll(args[1], ",", "."), 64)
+	if err != nil || price <= 0 {
+		bot.sendError(chatID, "Не удалось интерпретировать цену. Пример: 123.45")
+		return
+	}
+	err = bot.db.SetTransferPrice(chatID, db.TransferPrice{FIGI: instrument.FIGI, Ticker: instrument.Ticker, Price: price})
+	if err != nil {
+		bot.sendError(chatID, fmt.Sprintf("Ошибка записи цены покупки(%v)", err))
+		return
+	}
+	bot.sendText(chatID, "Принято", false)
+}
+
+// portfolioOptions returns portfolio options with user supplied data of the chat.
+func (bot *Bot) portfolioOptions(chatID int64) tinkoffinvest.PortfolioOptions {
+	opts := tinkoffinvest.PortfolioOptions{BaseCurrency: bot.baseCurrency}
+	if !bot.db.IsSet() {
+		return opts
+	}
+	items, err := bot.db.TransferPrices(chatID)
+	if err != nil {
+		bot.log.Error().Err(err).Int64("chatID", chatID).Msg("failed to get transfer prices")
+		return opts
+	}
+	opts.TransferPrices = make(map[string]float64, len(items))
+	for _, tp := range items {
+		opts.TransferPrices[tp.FIGI] = tp.Price
+	}
+	opts.CorporateActions, err = bot.db.CorporateActions(chatID)
+	if err != nil {
+		bot.log.Error().Err(err).Int64("chatID", chatID).Msg("failed to get corporate actions")
+	}
+	return opts
+}
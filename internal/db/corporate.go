@@ -0,0 +1,44 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+func (db Database) CorporateActions(chatID int64) ([]tinkoffinvest.CorporateAction, error) {
+	rows, err := db.pg.Query(
+		`SELECT id, effective_date, old_figi, new_figi, ratio FROM corporate_actions WHERE chat_id=$1 ORDER BY effective_date, id`,
+		chatID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+	items := make([]tinkoffinvest.CorporateAction, 0)
+	for rows.Next() {
+		var action tinkoffinvest.CorporateAction
+		if err = rows.Scan(&action.ID, &action.Date, &action.OldFIGI, &action.NewFIGI, &action.Ratio); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		items = append(items, action)
+	}
+	return items, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+func (db Database) AddCorporateAction(chatID int64, action tinkoffinvest.CorporateAction) error {
+	_, err := db.pg.Exec(
+		`INSERT INTO corporate_actions (chat_id, effective_date, old_figi, new_figi, ratio) VALUES ($1,$2,$3,$4,$5)`,
+		chatID, action.Date, action.OldFIGI, action.NewFIGI, action.Ratio,
+	)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteCorporateAction(chatID int64, id int64) error {
+	_, err := db.pg.Exec(`DELETE FROM corporate_actions WHERE chat_id=$1 AND id=$2`, chatID, id)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteCorporateActions(chatID int64) error {
+	_, err := db.pg.Exec(`DELETE FROM corporate_actions WHERE chat_id=$1`, chatID)
+	return errors.Wrap(err, "query failed")
+}
@@ -224,3 +224,23 @@ func sessionStartTime() time.Time {
 	}
 	return sessionStart.Local()
 }
+
+func (db Database) DefaultAccount(chatID int64) (string, error) {
+	var accountID string
+	err := db.pg.QueryRow(`SELECT account_id FROM default_accounts WHERE chat_id=$1`, chatID).Scan(&accountID)
+	return accountID, errors.Wrap(err, "query failed")
+}
+
+func (db Database) SetDefaultAccount(chatID int64, accountID string) error {
+	_, err := db.pg.Exec(
+		`INSERT INTO default_accounts (chat_id, account_id) VALUES ($1,$2)
+		ON CONFLICT(chat_id) DO UPDATE SET account_id=$2`,
+		chatID, accountID,
+	)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteDefaultAccount(chatID int64) error {
+	_, err := db.pg.Exec(`DELETE FROM default_accounts WHERE chat_id=$1`, chatID)
+	return errors.Wrap(err, "query failed")
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+// Operations returns stored operations of the account along with the moment they are complete up to,
+// as saved with them. Operations saved without it are complete up to the earliest one still in progress
+// or the latest stored one.
+func (db Database) Operations(chatID int64, accountID string) ([]sdk.Operation, time.Time, error) {
+	rows, err := db.pg.Query(
+		`SELECT data::text FROM operations WHERE chat_id=$1 AND account_id=$2 ORDER BY date_time`,
+		chatID, accountID,
+	)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+	var syncedTo, inProgress time.Time
+	items := make([]sdk.Operation, 0)
+	for rows.Next() {
+		var raw string
+		if err = rows.Scan(&raw); err != nil {
+			return nil, time.Time{}, errors.Wrap(err, "failed to scan row")
+		}
+		var op sdk.Operation
+		if err = json.Unmarshal([]byte(raw), &op); err != nil {
+			return nil, time.Time{}, errors.Wrap(err, "failed to decode operation")
+		}
+		if op.DateTime.After(syncedTo) {
+			syncedTo = op.DateTime
+		}
+		if op.Status == sdk.OperationStatusProgress && (inProgress.IsZero() || op.DateTime.Before(inProgress)) {
+			inProgress = op.DateTime
+		}
+		items = append(items, op)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "failed to read rows")
+	}
+	if !inProgress.IsZero() {
+		syncedTo = inProgress
+	}
+	var saved time.Time
+	err = db.pg.QueryRow(
+		`SELECT synced_to FROM operations_synced WHERE chat_id=$1 AND account_id=$2`, chatID, accountID,
+	).Scan(&saved)
+	switch {
+	case err == pgx.ErrNoRows:
+	case err != nil:
+		return nil, time.Time{}, errors.Wrap(err, "query failed")
+	default:
+		syncedTo = saved
+	}
+	return items, syncedTo, nil
+}
+
+// SaveOperations inserts new operations of the account and replaces already stored ones by
+// tinkoffinvest.OperationKey, so operations without an ID don't overwrite each other.
+// syncedTo is the moment the account operations are complete up to.
+func (db Database) SaveOperations(chatID int64, accountID string, operations []sdk.Operation, syncedTo time.Time) error {
+	tx, err := db.pg.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func(tx *pgx.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	for _, op := range operations {
+		raw, err := json.Marshal(op)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode operation")
+		}
+		_, err = tx.Exec(`INSERT INTO operations
+			(chat_id, account_id, operation_id, date_time, status, data)
+			VALUES
+			($1, $2, $3, $4, $5, $6::jsonb)
+			ON CONFLICT (chat_id, account_id, operation_id)
+			DO UPDATE SET date_time=$4, status=$5, data=$6::jsonb`,
+			chatID, accountID, tinkoffinvest.OperationKey(op), op.DateTime, string(op.Status), string(raw),
+		)
+		if err != nil {
+			return errors.Wrap(err, "query failed")
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO operations_synced
+		(chat_id, account_id, synced_to)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT (chat_id, account_id)
+		DO UPDATE SET synced_to=$3`,
+		chatID, accountID, syncedTo,
+	)
+	if err != nil {
+		return errors.Wrap(err, "query failed")
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit")
+}
+
+func (db Database) DeleteOperations(chatID int64) error {
+	_, err := db.pg.Exec(`DELETE FROM operations WHERE chat_id=$1`, chatID)
+	if err != nil {
+		return errors.Wrap(err, "query failed")
+	}
+	_, err = db.pg.Exec(`DELETE FROM operations_synced WHERE chat_id=$1`, chatID)
+	return errors.Wrap(err, "query failed")
+}
+
+type operationsStore struct {
+	db     Database
+	chatID int64
+}
+
+// OperationsStore binds operations storage to a chat.
+func (db Database) OperationsStore(chatID int64) tinkoffinvest.OperationsStore {
+	return operationsStore{db: db, chatID: chatID}
+}
+
+func (s operationsStore) Operations(accountID string) ([]sdk.Operation, time.Time, error) {
+	return s.db.Operations(s.chatID, accountID)
+}
+
+func (s operationsStore) SaveOperations(accountID string, operations []sdk.Operation, syncedTo time.Time) error {
+	return s.db.SaveOperations(s.chatID, accountID, operations, syncedTo)
+}
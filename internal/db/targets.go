@@ -0,0 +1,42 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+	"github.com/triamazikamno/tinkoff-invest/pkg/tinkoffinvest"
+)
+
+func (db Database) TargetWeights(chatID int64) ([]tinkoffinvest.TargetWeight, error) {
+	rows, err := db.pg.Query(`SELECT target, weight FROM target_weights WHERE chat_id=$1 ORDER BY target`, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+	items := make([]tinkoffinvest.TargetWeight, 0)
+	for rows.Next() {
+		var target tinkoffinvest.TargetWeight
+		if err = rows.Scan(&target.Target, &target.Weight); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		items = append(items, target)
+	}
+	return items, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+func (db Database) SetTargetWeight(chatID int64, target tinkoffinvest.TargetWeight) error {
+	_, err := db.pg.Exec(
+		`INSERT INTO target_weights (chat_id, target, weight) VALUES ($1,$2,$3)
+		ON CONFLICT(chat_id, target) DO UPDATE SET weight=$3`,
+		chatID, target.Target, target.Weight,
+	)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteTargetWeight(chatID int64, target string) error {
+	_, err := db.pg.Exec(`DELETE FROM target_weights WHERE chat_id=$1 AND target=$2`, chatID, target)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteTargetWeights(chatID int64) error {
+	_, err := db.pg.Exec(`DELETE FROM target_weights WHERE chat_id=$1`, chatID)
+	return errors.Wrap(err, "query failed")
+}
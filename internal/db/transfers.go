@@ -0,0 +1,51 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+)
+
+// TransferPrice is the purchase price of securities transferred in from another broker.
+type TransferPrice struct {
+	FIGI   string
+	Ticker string
+	Price  float64
+}
+
+func (db Database) TransferPrices(chatID int64) ([]TransferPrice, error) {
+	rows, err := db.pg.Query(
+		`SELECT figi, ticker, price FROM transfer_prices WHERE chat_id=$1 ORDER BY ticker`,
+		chatID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+	items := make([]TransferPrice, 0)
+	for rows.Next() {
+		var tp TransferPrice
+		if err = rows.Scan(&tp.FIGI, &tp.Ticker, &tp.Price); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		items = append(items, tp)
+	}
+	return items, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+func (db Database) SetTransferPrice(chatID int64, tp TransferPrice) error {
+	_, err := db.pg.Exec(
+		`INSERT INTO transfer_prices (chat_id, figi, ticker, price) VALUES ($1,$2,$3,$4)
+		ON CONFLICT(chat_id, figi) DO UPDATE SET ticker=$3, price=$4`,
+		chatID, tp.FIGI, tp.Ticker, tp.Price,
+	)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteTransferPrice(chatID int64, figi string) error {
+	_, err := db.pg.Exec(`DELETE FROM transfer_prices WHERE chat_id=$1 AND figi=$2`, chatID, figi)
+	return errors.Wrap(err, "query failed")
+}
+
+func (db Database) DeleteTransferPrices(chatID int64) error {
+	_, err := db.pg.Exec(`DELETE FROM transfer_prices WHERE chat_id=$1`, chatID)
+	return errors.Wrap(err, "query failed")
+}
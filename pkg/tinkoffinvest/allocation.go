@@ -0,0 +1,155 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+	"sort"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// AllocationSlice is a part of the portfolio, Weight is its share of the total in percent.
+type AllocationSlice struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+}
+
+// Allocation breaks the current portfolio value in the base currency down by several criteria.
+type Allocation struct {
+	BaseCurrency Currency          `json:"base_currency"`
+	Total        float64           `json:"total"`
+	ByType       []AllocationSlice `json:"by_type"`
+	ByCurrency   []AllocationSlice `json:"by_currency"`
+	// BySector is empty unless sectors are supplied, the broker API doesn't provide them.
+	BySector   []AllocationSlice `json:"by_sector"`
+	ByPosition []AllocationSlice `json:"by_position"`
+	// Unconverted lists currencies left out for lack of a rate.
+	Unconverted []Currency `json:"unconverted"`
+}
+
+var instrumentTypeNames = map[sdk.InstrumentType]string{
+	sdk.InstrumentTypeStock:    "Акции",
+	sdk.InstrumentTypeBond:     "Облигации",
+	sdk.InstrumentTypeEtf:      "Фонды",
+	sdk.InstrumentTypeCurrency: "Валюта",
+}
+
+// positionValue returns the current value of a position in its own currency.
+func positionValue(position sdk.PositionBalance, quotes map[string]float64) (Currency, float64) {
+	currency := Currency(position.AveragePositionPrice.Currency)
+	if position.AveragePositionPrice.Value == 0 {
+		return currency, position.Balance * quotes[position.FIGI]
+	}
+	return currency, position.AveragePositionPrice.Value*position.Balance + position.ExpectedYield.Value
+}
+
+// BuildAllocation values positions and free cash in the base currency, RUB if empty.
+// sectors maps FIGI to sector name and may be nil.
+func BuildAllocation(data PortfolioData, baseCurrency Currency, sectors map[string]string) Allocation {
+	if baseCurrency == "" {
+		baseCurrency = RUB
+	}
+	a := Allocation{BaseCurrency: baseCurrency}
+	byType := make(map[string]float64)
+	byCurrency := make(map[string]float64)
+	bySector := make(map[string]float64)
+	byPosition := make(map[string]float64)
+	unconverted := make(map[Currency]struct{})
+	add := func(name, sector string, t sdk.InstrumentType, currency Currency, amount float64) {
+		value, ok := data.Rates.Convert(amount, currency, baseCurrency)
+		if !ok {
+			unconverted[currency] = struct{}{}
+			return
+		}
+		a.Total += value
+		byType[instrumentTypeNames[t]] += value
+		byCurrency[currency.String()] += value
+		byPosition[name] += value
+		if sectors != nil {
+			if sector == "" {
+				sector = "Прочее"
+			}
+			bySector[sector] += value
+		}
+	}
+	for _, position := range data.Positions {
+		if position.InstrumentType == sdk.InstrumentTypeCurrency || position.Balance <= 0 {
+			continue
+		}
+		currency, value := positionValue(position, data.Quotes)
+		add(position.Ticker, sectors[position.FIGI], position.InstrumentType, currency, value)
+	}
+	for currency, balance := range data.Balances {
+		if balance <= 0 {
+			continue
+		}
+		add(currency.String(), "", sdk.InstrumentTypeCurrency, currency, balance)
+	}
+	a.ByType = allocationSlices(byType, a.Total)
+	a.ByCurrency = allocationSlices(byCurrency, a.Total)
+	a.BySector = allocationSlices(bySector, a.Total)
+	a.ByPosition = allocationSlices(byPosition, a.Total)
+	for currency := range unconverted {
+		a.Unconverted = append(a.Unconverted, currency)
+	}
+	return a
+}
+
+// allocationSlices orders slices from the largest.
+func allocationSlices(values map[string]float64, total float64) []AllocationSlice {
+	slices := make([]AllocationSlice, 0, len(values))
+	for name, value := range values {
+		slice := AllocationSlice{Name: name, Value: value}
+		if total != 0 {
+			slice.Weight = value * 100 / total
+		}
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].Value == slices[j].Value {
+			return slices[i].Name < slices[j].Name
+		}
+		return slices[i].Value > slices[j].Value
+	})
+	return slices
+}
+
+// TopSlices keeps the n largest slices and folds the rest into one named "Прочее".
+func TopSlices(slices []AllocationSlice, n int) []AllocationSlice {
+	if len(slices) <= n {
+		return slices
+	}
+	top := make([]AllocationSlice, n, n+1)
+	copy(top, slices[:n])
+	other := AllocationSlice{Name: "Прочее"}
+	for _, slice := range slices[n:] {
+		other.Value += slice.Value
+		other.Weight += slice.Weight
+	}
+	return append(top, other)
+}
+
+func (a Allocation) Summary() string {
+	summary := fmt.Sprintf("Стоимость: %s%.2f\n", a.BaseCurrency.Sign(), a.Total)
+	for _, group := range []struct {
+		title  string
+		slices []AllocationSlice
+	}{
+		{"По типу", a.ByType},
+		{"По валюте", a.ByCurrency},
+		{"По сектору", a.BySector},
+		{"По позициям", a.ByPosition},
+	} {
+		if len(group.slices) == 0 {
+			continue
+		}
+		summary += "\n" + group.title + ":\n"
+		for _, slice := range group.slices {
+			summary += fmt.Sprintf("%s %.2f%% (%s%.2f)\n", slice.Name, slice.Weight, a.BaseCurrency.Sign(), slice.Value)
+		}
+	}
+	if len(a.Unconverted) > 0 {
+		summary += fmt.Sprintf("\nНе учтено из-за отсутствия курса: %v\n", a.Unconverted)
+	}
+	return summary
+}
@@ -0,0 +1,69 @@
+package tinkoffinvest
+
+import (
+	"testing"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+func checkSlices(t *testing.T, name string, got []AllocationSlice, want []AllocationSlice) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %+v, want %+v", name, got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || !approxEqual(got[i].Value, want[i].Value) {
+			t.Errorf("%s[%d] = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestBuildAllocation(t *testing.T) {
+	data := PortfolioData{
+		Positions: map[string]sdk.PositionBalance{
+			"AAPL": {
+				FIGI: "AAPL", Ticker: "AAPL", InstrumentType: sdk.InstrumentTypeStock, Balance: 10,
+				AveragePositionPrice: sdk.MoneyAmount{Currency: sdk.USD, Value: 100},
+				ExpectedYield:        sdk.MoneyAmount{Currency: sdk.USD, Value: 50},
+			},
+			// no average price, valued at the quote
+			"SBER": {
+				FIGI: "SBER", Ticker: "SBER", InstrumentType: sdk.InstrumentTypeStock, Balance: 100,
+				AveragePositionPrice: sdk.MoneyAmount{Currency: sdk.RUB},
+			},
+			// no EUR rate
+			"SAP": {
+				FIGI: "SAP", Ticker: "SAP", InstrumentType: sdk.InstrumentTypeStock, Balance: 1,
+				AveragePositionPrice: sdk.MoneyAmount{Currency: sdk.EUR, Value: 120},
+			},
+		},
+		Quotes:   map[string]float64{"SBER": 250},
+		Rates:    Rates{USD: 75},
+		Balances: map[Currency]float64{RUB: 5000, USD: 10},
+	}
+
+	a := BuildAllocation(data, RUB, map[string]string{"AAPL": "IT"})
+	// 1050$ in AAPL, 25000 in SBER and 5000 + 10$ of free cash
+	if !approxEqual(a.Total, 109500) {
+		t.Errorf("total = %v, want 109500", a.Total)
+	}
+	checkSlices(t, "by type", a.ByType, []AllocationSlice{{Name: "Акции", Value: 103750}, {Name: "Валюта", Value: 5750}})
+	checkSlices(t, "by currency", a.ByCurrency, []AllocationSlice{{Name: "USD", Value: 79500}, {Name: "RUB", Value: 30000}})
+	checkSlices(t, "by sector", a.BySector, []AllocationSlice{{Name: "IT", Value: 78750}, {Name: "Прочее", Value: 30750}})
+	if len(a.Unconverted) != 1 || a.Unconverted[0] != EUR {
+		t.Errorf("unconverted = %v, want EUR", a.Unconverted)
+	}
+
+	top := TopSlices(a.ByPosition, 2)
+	checkSlices(t, "top positions", top, []AllocationSlice{
+		{Name: "AAPL", Value: 78750}, {Name: "SBER", Value: 25000}, {Name: "Прочее", Value: 5750},
+	})
+	if !approxEqual(top[2].Weight, 5750*100.0/109500) {
+		t.Errorf("other weight = %v", top[2].Weight)
+	}
+
+	// without sectors there's no breakdown by them
+	if a := BuildAllocation(data, RUB, nil); len(a.BySector) != 0 {
+		t.Errorf("by sector = %+v, want none", a.BySector)
+	}
+}
@@ -0,0 +1,104 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// tradesValue is the clean value of op trades, excluding accrued interest and commission.
+func tradesValue(op sdk.Operation) float64 {
+	var value float64
+	for _, trade := range op.Trades {
+		value += trade.Price * float64(trade.Quantity)
+	}
+	return value
+}
+
+// applyAccruedInterest books accrued coupon interest (НКД) a bond trade was settled with:
+// paid to the seller on purchase and received from the buyer on sale.
+func (item *PortfolioItem) applyAccruedInterest(op sdk.Operation) {
+	if item.InstrumentType != sdk.InstrumentTypeBond || len(op.Trades) == 0 {
+		return
+	}
+	var accrued float64
+	if op.OperationType == sdk.SELL {
+		accrued = op.Payment - tradesValue(op)
+	} else {
+		accrued = op.Payment + tradesValue(op)
+	}
+	if math.Abs(accrued) < 0.005 {
+		return
+	}
+	item.AccruedInterest += accrued
+}
+
+// amortize returns part of the face value, lowering the price of every open lot by the amount paid per bond.
+func (item *PortfolioItem) amortize(op sdk.Operation) {
+	item.Amortization += op.Payment
+	quantity := lotsQuantity(item.LongPositions)
+	if quantity < lotEpsilon {
+		return
+	}
+	perBond := op.Payment / quantity
+	for i := range item.LongPositions {
+		item.LongPositions[i].Price -= perBond
+	}
+}
+
+// redeem closes all open lots at the face value paid on bond maturity.
+func (item *PortfolioItem) redeem(op sdk.Operation, costBasis CostBasis) {
+	quantity := lotsQuantity(item.LongPositions)
+	if quantity < lotEpsilon {
+		item.Profit += op.Payment
+		return
+	}
+	redemption := op
+	redemption.OperationType = sdk.SELL
+	redemption.Commission = sdk.MoneyAmount{}
+	redemption.Trades = []sdk.Trade{{
+		ID:       op.ID,
+		DateTime: op.DateTime,
+		Price:    op.Payment / quantity,
+		Quantity: int(math.Round(quantity)),
+	}}
+	trades := len(item.Trades)
+	item.applyTrades(redemption, costBasis)
+	if len(item.Trades) > trades {
+		item.Trades[len(item.Trades)-1].Type = "погашение"
+	}
+}
+
+// YieldToDate is everything a bond earned so far, realized and potential, relative to the money spent on it.
+func (item PortfolioItem) YieldToDate() (float64, bool) {
+	if item.InstrumentType != sdk.InstrumentTypeBond || item.Invested <= 0 {
+		return 0, false
+	}
+	return (item.TotalProfit() + item.ExpectedYield) * 100 / item.Invested, true
+}
+
+func (item PortfolioItem) bondDetails() string {
+	if item.InstrumentType != sdk.InstrumentTypeBond {
+		return ""
+	}
+	income := make([]string, 0)
+	if item.Coupons != 0 {
+		income = append(income, fmt.Sprintf("купоны %s", formatMoney(item.Currency, item.Coupons)))
+	}
+	if item.AccruedInterest != 0 {
+		income = append(income, fmt.Sprintf("НКД %s", formatMoney(item.Currency, item.AccruedInterest)))
+	}
+	if item.Amortization != 0 {
+		income = append(income, fmt.Sprintf("амортизация %s%.2f", item.Currency.Sign(), item.Amortization))
+	}
+	var details string
+	if len(income) > 0 {
+		details += strings.Join(income, ", ") + "\n"
+	}
+	if yield, ok := item.YieldToDate(); ok {
+		details += fmt.Sprintf("Доходность: %s%.2f%%\n", numSign(yield), yield)
+	}
+	return details
+}
@@ -0,0 +1,79 @@
+package tinkoffinvest
+
+import (
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// CorporateAction is a split or an instrument change effective from Date.
+type CorporateAction struct {
+	ID   int64
+	Date time.Time
+	// OldFIGI is the instrument operations were made with before Date.
+	OldFIGI string
+	// NewFIGI replaces OldFIGI from Date on, empty if the instrument stays the same.
+	NewFIGI string
+	// Ratio is the number of new units for each old unit, 1 for a plain instrument change.
+	Ratio float64
+}
+
+func (action CorporateAction) figi() string {
+	if action.NewFIGI != "" {
+		return action.NewFIGI
+	}
+	return action.OldFIGI
+}
+
+type corporateActions []CorporateAction
+
+func newCorporateActions(actions []CorporateAction) corporateActions {
+	sorted := make(corporateActions, len(actions))
+	copy(sorted, actions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+	return sorted
+}
+
+// resolve follows instrument changes made after an operation with figi at the given moment
+// and returns the instrument it is known as now.
+func (actions corporateActions) resolve(figi string, at time.Time) string {
+	for _, action := range actions {
+		if action.OldFIGI == figi && at.Before(action.Date) {
+			figi = action.figi()
+		}
+	}
+	return figi
+}
+
+// entries returns ledger entries of splits for an instrument known now as figi.
+func (actions corporateActions) entries(figi, ticker string) []LedgerEntry {
+	entries := make([]LedgerEntry, 0)
+	for _, action := range actions {
+		if action.Ratio <= 0 || action.Ratio == 1 {
+			continue
+		}
+		if actions.resolve(action.OldFIGI, action.Date.Add(-time.Nanosecond)) != figi {
+			continue
+		}
+		entries = append(entries, LedgerEntry{
+			Kind:      LedgerCorporateAction,
+			Ticker:    ticker,
+			Operation: sdk.Operation{DateTime: action.Date, FIGI: figi, Status: sdk.OperationStatusDone},
+			Action:    action,
+		})
+	}
+	return entries
+}
+
+// split scales open lots so their cost stays the same while quantity changes by ratio.
+func (item *PortfolioItem) split(ratio float64) {
+	for _, lots := range [][]Lot{item.LongPositions, item.ShortPositions} {
+		for i := range lots {
+			lots[i].Quantity *= ratio
+			lots[i].Price /= ratio
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package tinkoffinvest
+
+import (
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// CostBasis selects which open lots are closed by an opposite trade.
+type CostBasis interface {
+	// Take closes up to quantity from lots and returns the closed parts along with the remaining lots.
+	Take(lots []Lot, quantity float64, op sdk.Operation) (closed []Lot, rest []Lot)
+}
+
+type costBasisFunc func(lots []Lot, quantity float64, op sdk.Operation) ([]Lot, []Lot)
+
+func (f costBasisFunc) Take(lots []Lot, quantity float64, op sdk.Operation) ([]Lot, []Lot) {
+	return f(lots, quantity, op)
+}
+
+var (
+	// FIFO closes the oldest lots first.
+	FIFO CostBasis = costBasisFunc(func(lots []Lot, quantity float64, _ sdk.Operation) ([]Lot, []Lot) {
+		return takeLots(lots, quantity, func([]Lot) int { return 0 })
+	})
+	// LIFO closes the most recent lots first.
+	LIFO CostBasis = costBasisFunc(func(lots []Lot, quantity float64, _ sdk.Operation) ([]Lot, []Lot) {
+		return takeLots(lots, quantity, func(lots []Lot) int { return len(lots) - 1 })
+	})
+	// AverageCost closes lots at the weighted average cost of everything held.
+	AverageCost CostBasis = costBasisFunc(func(lots []Lot, quantity float64, _ sdk.Operation) ([]Lot, []Lot) {
+		if held := lotsQuantity(lots); held > 0 {
+			avg := lotsCost(lots) / held
+			for i := range lots {
+				lots[i].Price = avg
+			}
+		}
+		return takeLots(lots, quantity, func([]Lot) int { return 0 })
+	})
+)
+
+// SpecificLot closes the lots chosen by pick, which returns an index into lots.
+// Out of range indexes fall back to FIFO.
+func SpecificLot(pick func(lots []Lot, op sdk.Operation) int) CostBasis {
+	return costBasisFunc(func(lots []Lot, quantity float64, op sdk.Operation) ([]Lot, []Lot) {
+		return takeLots(lots, quantity, func(lots []Lot) int { return pick(lots, op) })
+	})
+}
@@ -0,0 +1,190 @@
+package tinkoffinvest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+var testStart = time.Date(2021, 1, 11, 10, 0, 0, 0, time.UTC)
+
+// trade builds a done operation filled by a single trade on the given day after testStart.
+func trade(id string, typ sdk.OperationType, day, quantity int, price, fee float64) sdk.Operation {
+	at := testStart.AddDate(0, 0, day)
+	payment := price * float64(quantity)
+	if typ != sdk.SELL {
+		payment = -payment
+	}
+	return sdk.Operation{
+		ID:            id,
+		Status:        sdk.OperationStatusDone,
+		OperationType: typ,
+		DateTime:      at,
+		FIGI:          "BBG000000001",
+		Currency:      sdk.RUB,
+		Price:         price,
+		Quantity:      quantity,
+		Payment:       payment,
+		Commission:    sdk.MoneyAmount{Currency: sdk.RUB, Value: fee},
+		Trades:        []sdk.Trade{{ID: id, DateTime: at, Price: price, Quantity: quantity}},
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestCostBasis(t *testing.T) {
+	// picks the most expensive lot
+	highest := SpecificLot(func(lots []Lot, _ sdk.Operation) int {
+		best := 0
+		for i, lot := range lots {
+			if lot.Price > lots[best].Price {
+				best = i
+			}
+		}
+		return best
+	})
+	type lot struct {
+		quantity, price float64
+	}
+	tests := []struct {
+		name      string
+		costBasis CostBasis
+		ops       []sdk.Operation
+		profit    float64
+		long      []lot
+		short     []lot
+	}{
+		{
+			name:      "fifo partial close",
+			costBasis: FIFO,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 10, 100, -10),
+				trade("2", sdk.BUY, 1, 10, 120, -10),
+				trade("3", sdk.SELL, 2, 15, 130, -15),
+			},
+			profit: 10*30 + 5*10,
+			long:   []lot{{5, 120}},
+		},
+		{
+			name:      "lifo partial close",
+			costBasis: LIFO,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 10, 100, -10),
+				trade("2", sdk.BUY, 1, 10, 120, -10),
+				trade("3", sdk.SELL, 2, 15, 130, -15),
+			},
+			profit: 10*10 + 5*30,
+			long:   []lot{{5, 100}},
+		},
+		{
+			name:      "average cost partial close",
+			costBasis: AverageCost,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 10, 100, -10),
+				trade("2", sdk.BUY, 1, 10, 120, -10),
+				trade("3", sdk.SELL, 2, 15, 130, -15),
+			},
+			profit: 15 * 20,
+			long:   []lot{{5, 110}},
+		},
+		{
+			name:      "specific lot partial close",
+			costBasis: highest,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 10, 100, -10),
+				trade("2", sdk.BUY, 1, 10, 120, -10),
+				trade("3", sdk.BUY, 2, 10, 110, -10),
+				trade("4", sdk.SELL, 3, 15, 130, -15),
+			},
+			profit: 10*10 + 5*20,
+			long:   []lot{{10, 100}, {5, 110}},
+		},
+		{
+			name:      "fifo sell flips into short",
+			costBasis: FIFO,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 10, 100, -10),
+				trade("2", sdk.SELL, 1, 15, 90, -15),
+			},
+			profit: 10 * -10,
+			short:  []lot{{5, 90}},
+		},
+		{
+			name:      "lifo sell flips into short",
+			costBasis: LIFO,
+			ops: []sdk.Operation{
+				trade("1", sdk.BUY, 0, 5, 100, -5),
+				trade("2", sdk.BUY, 1, 5, 110, -5),
+				trade("3", sdk.SELL, 2, 15, 120, -15),
+			},
+			profit: 5*10 + 5*20,
+			short:  []lot{{5, 120}},
+		},
+		{
+			name:      "average cost buy closes short",
+			costBasis: AverageCost,
+			ops: []sdk.Operation{
+				trade("1", sdk.SELL, 0, 10, 100, -10),
+				trade("2", sdk.SELL, 1, 10, 80, -10),
+				trade("3", sdk.BUY, 2, 5, 70, -5),
+			},
+			profit: 5 * 20,
+			short:  []lot{{5, 90}, {10, 90}},
+		},
+		{
+			name:      "specific lot buy closes short and flips long",
+			costBasis: highest,
+			ops: []sdk.Operation{
+				trade("1", sdk.SELL, 0, 10, 100, -10),
+				trade("2", sdk.SELL, 1, 10, 80, -10),
+				trade("3", sdk.BUY, 2, 25, 90, -25),
+			},
+			profit: 10*10 + 10*-10,
+			long:   []lot{{5, 90}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item PortfolioItem
+			for _, op := range tt.ops {
+				item.applyTrades(op, tt.costBasis)
+			}
+			if !approxEqual(item.Profit, tt.profit) {
+				t.Errorf("profit = %v, want %v", item.Profit, tt.profit)
+			}
+			for _, side := range []struct {
+				name string
+				got  []Lot
+				want []lot
+			}{
+				{"long", item.LongPositions, tt.long},
+				{"short", item.ShortPositions, tt.short},
+			} {
+				if len(side.got) != len(side.want) {
+					t.Fatalf("%s lots = %+v, want %+v", side.name, side.got, side.want)
+				}
+				for i, want := range side.want {
+					if !approxEqual(side.got[i].Quantity, want.quantity) || !approxEqual(side.got[i].Price, want.price) {
+						t.Errorf("%s lot %d = %v@%v, want %v@%v",
+							side.name, i, side.got[i].Quantity, side.got[i].Price, want.quantity, want.price)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTakeLotsSplitsFee(t *testing.T) {
+	lots := []Lot{{Quantity: 10, Price: 100, Fee: -10}}
+	closed, rest := FIFO.Take(lots, 4, sdk.Operation{})
+	if len(closed) != 1 || !approxEqual(closed[0].Quantity, 4) || !approxEqual(closed[0].Fee, -4) {
+		t.Fatalf("closed = %+v, want 4 units with fee -4", closed)
+	}
+	if len(rest) != 1 || !approxEqual(rest[0].Quantity, 6) || !approxEqual(rest[0].Fee, -6) {
+		t.Fatalf("rest = %+v, want 6 units with fee -6", rest)
+	}
+}
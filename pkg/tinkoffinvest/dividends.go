@@ -0,0 +1,256 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/pkg/errors"
+)
+
+// IncomePayment is a dividend or coupon payment, either received or expected.
+type IncomePayment struct {
+	Date     time.Time         `json:"date"`
+	FIGI     string            `json:"figi"`
+	Ticker   string            `json:"ticker"`
+	Type     sdk.OperationType `json:"type"`
+	Currency Currency          `json:"currency"`
+	// PerUnit is the amount paid for each unit held.
+	PerUnit float64 `json:"per_unit"`
+	Amount  float64 `json:"amount"`
+}
+
+// defaultPaymentInterval is assumed for instruments that paid only once so far.
+const defaultPaymentInterval = 365 * 24 * time.Hour
+
+// ForecastIncome projects dividends and coupons of currently held positions for the given number of months,
+// repeating the last amount paid per unit at the usual interval between past payments.
+// Coupons of amortized bonds with a known face value shrink with the projected amortizations
+// and stop once it is repaid.
+func ForecastIncome(data PortfolioData, months int) []IncomePayment {
+	now := data.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	till := now.AddDate(0, months, 0)
+
+	tickers := make(map[string]string)
+	for _, list := range [][]sdk.Instrument{data.Instruments.Stocks, data.Instruments.Bonds, data.Instruments.ETFs} {
+		for _, instrument := range list {
+			tickers[instrument.FIGI] = instrument.Ticker
+		}
+	}
+
+	amortizations := paymentHistory(data.Operations, data.Instruments, sdk.OperationTypePartRepayment)
+	forecast := make([]IncomePayment, 0)
+	for figi, history := range PaymentHistory(data.Operations, data.Instruments) {
+		position, ok := data.Positions[figi]
+		if !ok || position.Balance <= 0 || len(history) == 0 {
+			continue
+		}
+		last := history[len(history)-1]
+		interval := paymentInterval(history)
+		principal := newPrincipalSchedule(data.FaceValues[figi], last, amortizations[figi])
+		for next := last.Date.Add(interval); !next.After(till); next = next.Add(interval) {
+			share, ok := principal.outstanding(next)
+			if !ok {
+				break
+			}
+			if next.Before(now) {
+				continue
+			}
+			forecast = append(forecast, IncomePayment{
+				Date:     next,
+				FIGI:     figi,
+				Ticker:   tickers[figi],
+				Type:     last.Type,
+				Currency: last.Currency,
+				PerUnit:  last.PerUnit * share,
+				Amount:   last.PerUnit * share * position.Balance,
+			})
+		}
+	}
+	sort.Slice(forecast, func(i, j int) bool {
+		if forecast[i].Date.Equal(forecast[j].Date) {
+			return forecast[i].Ticker < forecast[j].Ticker
+		}
+		return forecast[i].Date.Before(forecast[j].Date)
+	})
+	return forecast
+}
+
+// principalSchedule projects amortizations of a bond from the last one at the usual interval.
+type principalSchedule struct {
+	// face is the current face value, zero if it isn't known or the bond isn't amortized
+	face float64
+	// couponFace is the face value the last coupon was paid on
+	couponFace   float64
+	amortization float64
+	interval     time.Duration
+	next         time.Time
+}
+
+func newPrincipalSchedule(face float64, lastCoupon IncomePayment, amortizations []IncomePayment) principalSchedule {
+	if face <= 0 || len(amortizations) == 0 {
+		return principalSchedule{}
+	}
+	last := amortizations[len(amortizations)-1]
+	s := principalSchedule{
+		face:         face,
+		couponFace:   face,
+		amortization: last.PerUnit,
+		interval:     paymentInterval(amortizations),
+	}
+	s.next = last.Date.Add(s.interval)
+	// amortizations paid since the last coupon, a coupon is paid on the face value before the amortization of the day
+	for _, amortization := range amortizations {
+		if !amortization.Date.Before(lastCoupon.Date) || sameDay(amortization.Date, lastCoupon.Date) {
+			s.couponFace += amortization.PerUnit
+		}
+	}
+	return s
+}
+
+// outstanding returns the share of the face value the last coupon was paid on that is left on date,
+// false once the bond is repaid.
+func (s *principalSchedule) outstanding(date time.Time) (float64, bool) {
+	if s.face == 0 {
+		return 1, true
+	}
+	for s.next.Before(date) && !sameDay(s.next, date) {
+		s.face -= s.amortization
+		s.next = s.next.Add(s.interval)
+	}
+	if s.face < lotEpsilon {
+		return 0, false
+	}
+	return s.face / s.couponFace, true
+}
+
+// FaceValues fetches the current face value of held bonds for PortfolioData.FaceValues.
+func (ti *TinkoffInvest) FaceValues(ctx context.Context, data PortfolioData) (map[string]float64, error) {
+	faceValues := make(map[string]float64)
+	for _, bond := range data.Instruments.Bonds {
+		if position, ok := data.Positions[bond.FIGI]; !ok || position.Balance <= 0 {
+			continue
+		}
+		orderbook, err := ti.Broker.Orderbook(ctx, 1, bond.FIGI)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get order book for %s", bond.FIGI)
+		}
+		if orderbook.FaceValue > 0 {
+			faceValues[bond.FIGI] = orderbook.FaceValue
+		}
+	}
+	return faceValues, nil
+}
+
+// PaymentHistory returns past dividends and coupons by FIGI, with payments of the same day combined
+// and the amount per unit derived from the quantity held at the time.
+func PaymentHistory(operations []sdk.Operation, instruments Instruments) map[string][]IncomePayment {
+	return paymentHistory(operations, instruments, sdk.OperationTypeDividend, sdk.OperationTypeCoupon)
+}
+
+func paymentHistory(operations []sdk.Operation, instruments Instruments, types ...sdk.OperationType) map[string][]IncomePayment {
+	wanted := make(map[sdk.OperationType]struct{}, len(types))
+	for _, typ := range types {
+		wanted[typ] = struct{}{}
+	}
+	ops := make([]sdk.Operation, 0, len(operations))
+	for _, op := range operations {
+		if op.Status == sdk.OperationStatusDone {
+			ops = append(ops, op)
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].DateTime.Before(ops[j].DateTime)
+	})
+	currencyFigis := instruments.currencyFigis()
+	cash := make(map[Currency]float64)
+	quantity := make(map[string]float64)
+	history := make(map[string][]IncomePayment)
+	for _, op := range ops {
+		applyOperationBalance(op, currencyFigis, cash, quantity)
+		if _, ok := wanted[op.OperationType]; !ok {
+			continue
+		}
+		if op.FIGI == "" || quantity[op.FIGI] <= 0 || op.Payment <= 0 {
+			continue
+		}
+		payments := history[op.FIGI]
+		if n := len(payments); n > 0 && sameDay(payments[n-1].Date, op.DateTime) {
+			payments[n-1].Amount += op.Payment
+			payments[n-1].PerUnit = payments[n-1].Amount / quantity[op.FIGI]
+			continue
+		}
+		history[op.FIGI] = append(payments, IncomePayment{
+			Date:     op.DateTime,
+			FIGI:     op.FIGI,
+			Type:     op.OperationType,
+			Currency: Currency(op.Currency),
+			PerUnit:  op.Payment / quantity[op.FIGI],
+			Amount:   op.Payment,
+		})
+	}
+	return history
+}
+
+// paymentInterval is the median interval between payments.
+func paymentInterval(history []IncomePayment) time.Duration {
+	if len(history) < 2 {
+		return defaultPaymentInterval
+	}
+	intervals := make([]time.Duration, 0, len(history)-1)
+	for i := 1; i < len(history); i++ {
+		intervals = append(intervals, history[i].Date.Sub(history[i-1].Date))
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i] < intervals[j]
+	})
+	interval := intervals[len(intervals)/2]
+	if interval < 24*time.Hour {
+		return defaultPaymentInterval
+	}
+	return interval
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// MonthlyIncome sums payments by currency into consecutive months starting with the month of from.
+func MonthlyIncome(payments []IncomePayment, from time.Time, months int) map[Currency][]float64 {
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	totals := make(map[Currency][]float64)
+	for _, payment := range payments {
+		date := payment.Date.In(from.Location())
+		i := (date.Year()-start.Year())*12 + int(date.Month()) - int(start.Month())
+		if i < 0 || i >= months {
+			continue
+		}
+		if _, ok := totals[payment.Currency]; !ok {
+			totals[payment.Currency] = make([]float64, months)
+		}
+		totals[payment.Currency][i] += payment.Amount
+	}
+	return totals
+}
+
+// IncomeForecastSummary lists expected payments.
+func IncomeForecastSummary(payments []IncomePayment) string {
+	var summary string
+	for _, payment := range payments {
+		kind := "див"
+		if payment.Type == sdk.OperationTypeCoupon {
+			kind = "куп"
+		}
+		summary += fmt.Sprintf(
+			"%s %s %s %s%.2f (%s%.4f/шт)\n",
+			payment.Date.Format("2006/01/02"), payment.Ticker, kind,
+			payment.Currency.Sign(), payment.Amount, payment.Currency.Sign(), payment.PerUnit,
+		)
+	}
+	return summary
+}
@@ -0,0 +1,63 @@
+package tinkoffinvest
+
+import (
+	"testing"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+func TestForecastIncomeStopsAtRedemption(t *testing.T) {
+	const figi = "BBG000000001"
+	payment := func(id string, typ sdk.OperationType, day int, amount float64) sdk.Operation {
+		return sdk.Operation{
+			ID:            id,
+			Status:        sdk.OperationStatusDone,
+			OperationType: typ,
+			DateTime:      testStart.AddDate(0, 0, day),
+			FIGI:          figi,
+			Currency:      sdk.RUB,
+			Payment:       amount,
+		}
+	}
+	data := PortfolioData{
+		Operations: []sdk.Operation{
+			trade("1", sdk.BUY, 0, 10, 1000, 0),
+			payment("2", sdk.OperationTypeCoupon, 30, 100),
+			payment("3", sdk.OperationTypeCoupon, 60, 100),
+			payment("4", sdk.OperationTypePartRepayment, 60, 2500),
+			payment("5", sdk.OperationTypeCoupon, 90, 75),
+			payment("6", sdk.OperationTypePartRepayment, 90, 2500),
+		},
+		Instruments: Instruments{Bonds: []sdk.Instrument{{FIGI: figi, Ticker: "AMRT", Currency: sdk.RUB}}},
+		Positions: map[string]sdk.PositionBalance{
+			figi: {FIGI: figi, InstrumentType: sdk.InstrumentTypeBond, Balance: 10},
+		},
+		FaceValues: map[string]float64{figi: 500},
+		Time:       testStart.AddDate(0, 0, 95),
+	}
+
+	// 250 of the 500 left is repaid on day 120 and the rest on day 150, the coupons of those days
+	// are still paid on the face value before the amortization
+	forecast := ForecastIncome(data, 6)
+	want := []struct {
+		day    int
+		amount float64
+	}{{120, 50}, {150, 25}}
+	if len(forecast) != len(want) {
+		t.Fatalf("forecast = %+v, want %d coupons", forecast, len(want))
+	}
+	for i, payment := range forecast {
+		if date := testStart.AddDate(0, 0, want[i].day); !payment.Date.Equal(date) {
+			t.Errorf("coupon %d date = %v, want %v", i, payment.Date, date)
+		}
+		if !approxEqual(payment.Amount, want[i].amount) {
+			t.Errorf("coupon %d amount = %v, want %v", i, payment.Amount, want[i].amount)
+		}
+	}
+
+	// without the face value the repayment can't be projected
+	data.FaceValues = nil
+	if forecast := ForecastIncome(data, 6); len(forecast) != 6 {
+		t.Errorf("forecast without face values has %d coupons, want 6", len(forecast))
+	}
+}
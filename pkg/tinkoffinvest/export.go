@@ -0,0 +1,113 @@
+package tinkoffinvest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Table is a titled grid of cells holding either strings or float64 numbers.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   [][]interface{}
+}
+
+// WriteCSV writes tables one after another separated by blank lines, each starting with its name and header.
+func WriteCSV(w io.Writer, tables []Table) error {
+	cw := csv.NewWriter(w)
+	for i, table := range tables {
+		if i > 0 {
+			if err := cw.Write([]string{}); err != nil {
+				return errors.Wrap(err, "failed to write csv")
+			}
+		}
+		records := [][]string{{table.Name}, table.Header}
+		for _, row := range table.Rows {
+			record := make([]string, len(row))
+			for j, cell := range row {
+				switch v := cell.(type) {
+				case float64:
+					record[j] = strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+				case nil:
+				default:
+					record[j] = fmt.Sprint(v)
+				}
+			}
+			records = append(records, record)
+		}
+		if err := cw.WriteAll(records); err != nil {
+			return errors.Wrap(err, "failed to write csv")
+		}
+	}
+	return nil
+}
+
+// Tables lays the portfolio out for export: a row per instrument, closed trades and open lots.
+func (p Portfolio) Tables() []Table {
+	items := Table{
+		Name: "Позиции",
+		Header: []string{
+			"Тикер", "FIGI", "Тип", "Валюта", "Количество", "Прибыль", "Дивиденды", "Купоны", "НКД",
+			"Комиссии", "Налог", "Итого получено", "В портфеле", "Потенциал", "Потенциал, %",
+		},
+	}
+	trades := Table{
+		Name: "Сделки",
+		Header: []string{
+			"Тикер", "Дата", "Тип", "Количество", "Прибыль", "Прибыль, %", "Комиссии", "Дней в позиции",
+		},
+	}
+	lots := Table{
+		Name:   "Лоты",
+		Header: []string{"Тикер", "Дата", "Количество", "Цена", "Комиссия", "Операция"},
+	}
+	for _, item := range p.Items {
+		if item.Ticker == "" {
+			continue
+		}
+		items.Rows = append(items.Rows, []interface{}{
+			item.Ticker, item.FIGI, string(item.InstrumentType), string(item.Currency), item.Quantity(),
+			item.Profit, item.Dividends, item.Coupons, item.AccruedInterest,
+			item.Fee, item.Tax, item.TotalProfit(), item.Holdings, item.ExpectedYield, item.ExpectedYieldPc,
+		})
+		for _, trade := range item.Trades {
+			trades.Rows = append(trades.Rows, []interface{}{
+				item.Ticker, formatDate(trade.Date), trade.Type, trade.Quantity,
+				trade.Profit, trade.ProfitPc, trade.Fee, float64(holdingDays(trade.HoldingPeriod)),
+			})
+		}
+		for _, lot := range item.LongPositions {
+			lots.Rows = append(lots.Rows, []interface{}{
+				item.Ticker, formatDate(lot.Date), lot.Quantity, lot.Price, lot.Fee, lot.OperationID,
+			})
+		}
+		for _, lot := range item.ShortPositions {
+			lots.Rows = append(lots.Rows, []interface{}{
+				item.Ticker, formatDate(lot.Date), -lot.Quantity, lot.Price, lot.Fee, lot.OperationID,
+			})
+		}
+	}
+	return []Table{items, trades, lots}
+}
+
+func (p Portfolio) WriteCSV(w io.Writer) error {
+	return WriteCSV(w, p.Tables())
+}
+
+// WriteJSON writes the whole portfolio including trades and open lots.
+func (p Portfolio) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(p), "failed to encode portfolio")
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,137 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+)
+
+// currencyTickers maps tickers of currency instruments to the currency they trade.
+var currencyTickers = map[string]Currency{
+	"USD000UTSTOM": USD,
+	"EUR_RUB__TOM": EUR,
+}
+
+// currencyFigis maps FIGIs of known currency instruments to the currency they trade.
+func (i Instruments) currencyFigis() map[string]Currency {
+	figis := make(map[string]Currency)
+	for _, instrument := range i.Currencies {
+		if currency, ok := currencyTickers[instrument.Ticker]; ok {
+			figis[instrument.FIGI] = currency
+		}
+	}
+	return figis
+}
+
+// Rates holds the price of a single unit of currency in rubles.
+type Rates map[Currency]float64
+
+func (r Rates) rate(c Currency) (float64, bool) {
+	if c == RUB {
+		return 1, true
+	}
+	rate, ok := r[c]
+	return rate, ok && rate > 0
+}
+
+// Convert converts amount from one currency to another, returning false if either rate is unknown.
+func (r Rates) Convert(amount float64, from, to Currency) (float64, bool) {
+	if from == to {
+		return amount, true
+	}
+	fromRate, ok := r.rate(from)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := r.rate(to)
+	if !ok {
+		return 0, false
+	}
+	return amount * fromRate / toRate, true
+}
+
+// Consolidate sums per currency amounts in the portfolio base currency.
+func (p Portfolio) Consolidate(amounts map[Currency]float64) (float64, bool) {
+	var total float64
+	for currency, amount := range amounts {
+		if amount == 0 {
+			continue
+		}
+		converted, ok := p.Rates.Convert(amount, currency, p.BaseCurrency)
+		if !ok {
+			return 0, false
+		}
+		total += converted
+	}
+	return total, true
+}
+
+func (p Portfolio) consolidatedSummary() string {
+	base := p.BaseCurrency
+	profit, ok := p.Consolidate(p.TotalProfit)
+	if !ok {
+		return ""
+	}
+	position, ok := p.Consolidate(p.TotalPosition)
+	if !ok {
+		return ""
+	}
+	potentialProfit, ok := p.Consolidate(p.TotalPotentialProfit)
+	if !ok {
+		return ""
+	}
+	fxProfit, ok := p.Rates.Convert(sumValues(p.FXProfit), RUB, base)
+	if !ok {
+		return ""
+	}
+	var profitPc float64
+	if position != 0 {
+		profitPc = potentialProfit * 100 / position
+	}
+	summary := fmt.Sprintf("\nИтого в %s:\n", base.String())
+	summary += fmt.Sprintf("полученная прибыль: %s\n", formatMoney(base, profit))
+	summary += fmt.Sprintf("вложений: %s%.2f\n", base.Sign(), position)
+	summary += fmt.Sprintf(
+		"потенциальная прибыль: %s (%s%.2f%%)\n",
+		formatMoney(base, potentialProfit), numSign(profitPc), profitPc,
+	)
+	if fxProfit != 0 {
+		summary += fmt.Sprintf("в т.ч. на обмене валют: %s\n", formatMoney(base, fxProfit))
+	}
+	for _, currency := range Currencies {
+		if rate, ok := p.Rates.rate(currency); ok && currency != RUB {
+			summary += fmt.Sprintf("курс %s: %s%.4f\n", currency.String(), RUB.Sign(), rate)
+		}
+	}
+	return summary
+}
+
+func (p Portfolio) fxSummary() string {
+	var summary string
+	for _, item := range p.Items {
+		currency, ok := item.TradedCurrency()
+		if !ok {
+			continue
+		}
+		summary += fmt.Sprintf(
+			"%s обмен: %s (ком %.2f)",
+			currency.String(), formatMoney(item.Currency, item.Profit), -1*item.Fee,
+		)
+		if held := lotsQuantity(item.LongPositions); held > lotEpsilon {
+			summary += fmt.Sprintf(
+				", куплено %s%.2f по %s%.4f",
+				currency.Sign(), held, item.Currency.Sign(), lotsCost(item.LongPositions)/held,
+			)
+		}
+		summary += "\n"
+	}
+	if summary == "" {
+		return ""
+	}
+	return "\nВалюта:\n" + summary
+}
+
+func sumValues(m map[Currency]float64) (sum float64) {
+	for _, v := range m {
+		sum += v
+	}
+	return sum
+}
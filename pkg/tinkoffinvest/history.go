@@ -0,0 +1,198 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/pkg/errors"
+)
+
+// PriceHistory holds daily candles by FIGI sorted by time.
+type PriceHistory map[string][]sdk.Candle
+
+// EquityPoint is the value of money held in a single currency at the end of a day.
+type EquityPoint struct {
+	Date  time.Time
+	Value float64
+	// Flow is the net external cash flow during the day, see CashFlows.
+	Flow float64
+}
+
+// PriceHistory fetches daily candles for every non currency instrument traded in operations,
+// starting from the first operation with it.
+func (ti *TinkoffInvest) PriceHistory(ctx context.Context, operations []sdk.Operation, to time.Time) (PriceHistory, error) {
+	starts := make(map[string]time.Time)
+	for _, op := range operations {
+		if op.FIGI == "" || op.InstrumentType == sdk.InstrumentTypeCurrency || op.Status != sdk.OperationStatusDone {
+			continue
+		}
+		if start, ok := starts[op.FIGI]; !ok || op.DateTime.Before(start) {
+			starts[op.FIGI] = op.DateTime
+		}
+	}
+	history := make(PriceHistory)
+	for figi, from := range starts {
+		candles, err := ti.DailyCandles(ctx, figi, from, to)
+		if err != nil {
+			return nil, err
+		}
+		history[figi] = candles
+	}
+	return history, nil
+}
+
+// DailyCandles fetches daily candles over an arbitrary range in yearly chunks the API allows, sorted by time.
+func (ti *TinkoffInvest) DailyCandles(ctx context.Context, figi string, from, to time.Time) ([]sdk.Candle, error) {
+	candles := make([]sdk.Candle, 0)
+	for from.Before(to) {
+		till := from.Add(365 * 24 * time.Hour)
+		if till.After(to) {
+			till = to
+		}
+		part, err := ti.Broker.Candles(ctx, from, till, sdk.CandleInterval1Day, figi)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get candles for %s", figi)
+		}
+		candles = append(candles, part...)
+		from = till
+	}
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].TS.Before(candles[j].TS)
+	})
+	return candles, nil
+}
+
+// EquityCurve replays operations day by day and values positions at daily close prices,
+// producing a curve per currency the account ever held. Bonds are valued at cost, their candles
+// are quoted in percent of a face value operations don't carry.
+func EquityCurve(operations []sdk.Operation, instruments Instruments, prices PriceHistory, to time.Time) map[Currency][]EquityPoint {
+	ops := make([]sdk.Operation, 0, len(operations))
+	for _, op := range operations {
+		if op.Status == sdk.OperationStatusDone {
+			ops = append(ops, op)
+		}
+	}
+	curves := make(map[Currency][]EquityPoint)
+	if len(ops) == 0 {
+		return curves
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].DateTime.Before(ops[j].DateTime)
+	})
+
+	currencyFigis := instruments.currencyFigis()
+	instrumentCurrency := make(map[string]Currency)
+	for _, list := range [][]sdk.Instrument{instruments.Stocks, instruments.Bonds, instruments.ETFs} {
+		for _, instrument := range list {
+			instrumentCurrency[instrument.FIGI] = Currency(instrument.Currency)
+		}
+	}
+	bondCost := make(map[string]float64)
+	for _, bond := range instruments.Bonds {
+		bondCost[bond.FIGI] = 0
+	}
+
+	cash := make(map[Currency]float64)
+	quantity := make(map[string]float64)
+	lastPrice := make(map[string]float64)
+	priceIdx := make(map[string]int)
+	var opIdx int
+	for day := ops[0].DateTime.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		end := day.Add(24 * time.Hour)
+		flows := make(map[Currency]float64)
+		for ; opIdx < len(ops) && ops[opIdx].DateTime.Before(end); opIdx++ {
+			op := ops[opIdx]
+			if _, ok := bondCost[op.FIGI]; ok {
+				bondCost[op.FIGI] = applyBondCost(op, quantity[op.FIGI], bondCost[op.FIGI])
+			}
+			applyOperationBalance(op, currencyFigis, cash, quantity)
+			for currency, amount := range operationFlows(op, currencyFigis) {
+				flows[currency] += amount
+			}
+		}
+		for figi := range quantity {
+			candles := prices[figi]
+			i := priceIdx[figi]
+			for ; i < len(candles) && candles[i].TS.Before(end); i++ {
+				lastPrice[figi] = candles[i].ClosePrice
+			}
+			priceIdx[figi] = i
+		}
+		values := make(map[Currency]float64)
+		for currency, amount := range cash {
+			values[currency] += amount
+		}
+		for figi, q := range quantity {
+			if cost, ok := bondCost[figi]; ok {
+				values[instrumentCurrency[figi]] += cost
+				continue
+			}
+			values[instrumentCurrency[figi]] += q * lastPrice[figi]
+		}
+		for currency, value := range values {
+			if currency == "" {
+				continue
+			}
+			curves[currency] = append(curves[currency], EquityPoint{Date: day, Value: value, Flow: flows[currency]})
+		}
+	}
+	return curves
+}
+
+// applyBondCost returns the cost of a bond position of held units after op, sales take the average cost
+// and amortization returns a part of it.
+func applyBondCost(op sdk.Operation, held, cost float64) float64 {
+	switch op.OperationType {
+	case sdk.BUY, sdk.OperationTypeBuyCard:
+		return cost + tradesValue(op)
+	case sdk.SELL:
+		if held <= 0 {
+			return cost
+		}
+		return cost * math.Max(held-tradedQuantity(op), 0) / held
+	case sdk.OperationTypeSecurityOut:
+		if held <= 0 {
+			return cost
+		}
+		return cost * math.Max(held-transferQuantity(op), 0) / held
+	case sdk.OperationTypePartRepayment:
+		return math.Max(cost-op.Payment, 0)
+	case sdk.OperationTypeRepayment:
+		return 0
+	}
+	return cost
+}
+
+// applyOperationBalance updates cash and instrument quantities held after op.
+func applyOperationBalance(op sdk.Operation, currencyFigis map[string]Currency, cash map[Currency]float64, quantity map[string]float64) {
+	cash[Currency(op.Currency)] += op.Payment
+	if op.OperationType == sdk.OperationTypeBuyCard {
+		cash[Currency(op.Currency)] -= op.Payment
+	}
+	var delta float64
+	switch op.OperationType {
+	case sdk.BUY, sdk.OperationTypeBuyCard:
+		delta = tradedQuantity(op)
+	case sdk.SELL:
+		delta = -tradedQuantity(op)
+	case sdk.OperationTypeSecurityIn:
+		delta = transferQuantity(op)
+	case sdk.OperationTypeSecurityOut:
+		delta = -transferQuantity(op)
+	case sdk.OperationTypeRepayment:
+		delete(quantity, op.FIGI)
+		return
+	default:
+		return
+	}
+	if traded, ok := currencyFigis[op.FIGI]; ok {
+		cash[traded] += delta
+		return
+	}
+	if op.FIGI != "" {
+		quantity[op.FIGI] += delta
+	}
+}
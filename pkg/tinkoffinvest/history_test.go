@@ -0,0 +1,56 @@
+package tinkoffinvest
+
+import (
+	"testing"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+func TestEquityCurveValuesBondsAtCost(t *testing.T) {
+	const figi = "BBG000000001"
+	instruments := Instruments{Bonds: []sdk.Instrument{{FIGI: figi, Ticker: "OFZ", Currency: sdk.RUB}}}
+	amortization := sdk.Operation{
+		ID:            "4",
+		Status:        sdk.OperationStatusDone,
+		OperationType: sdk.OperationTypePartRepayment,
+		DateTime:      testStart.AddDate(0, 0, 4),
+		FIGI:          figi,
+		Currency:      sdk.RUB,
+		Payment:       600,
+	}
+	operations := []sdk.Operation{
+		{
+			ID:            "1",
+			Status:        sdk.OperationStatusDone,
+			OperationType: sdk.OperationTypePayIn,
+			DateTime:      testStart,
+			Currency:      sdk.RUB,
+			Payment:       100000,
+		},
+		trade("2", sdk.BUY, 1, 10, 1000, 0),
+		trade("3", sdk.SELL, 3, 4, 1010, 0),
+		amortization,
+	}
+	// candles of bonds are in percent of face value and must not be taken for a price
+	prices := PriceHistory{figi: {
+		{FIGI: figi, TS: testStart.AddDate(0, 0, 1), ClosePrice: 101},
+		{FIGI: figi, TS: testStart.AddDate(0, 0, 3), ClosePrice: 101},
+	}}
+
+	curve := EquityCurve(operations, instruments, prices, testStart.AddDate(0, 0, 4))[RUB]
+	want := []float64{
+		100000, // paid in
+		100000, // 90000 of cash and 10 bonds bought for 10000
+		100000,
+		100040, // 94040 of cash and 6 bonds left of 10000
+		100040, // 600 of the 6000 returned by amortization
+	}
+	if len(curve) != len(want) {
+		t.Fatalf("curve = %+v, want %d points", curve, len(want))
+	}
+	for i, point := range curve {
+		if !approxEqual(point.Value, want[i]) {
+			t.Errorf("day %d value = %v, want %v", i, point.Value, want[i])
+		}
+	}
+}
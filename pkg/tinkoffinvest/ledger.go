@@ -0,0 +1,103 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// LedgerKind tells how an operation affects the portfolio.
+type LedgerKind int
+
+const (
+	// LedgerTrade buys or sells an instrument.
+	LedgerTrade LedgerKind = iota + 1
+	// LedgerIncome is dividend or coupon income.
+	LedgerIncome
+	// LedgerPrincipal returns bond face value.
+	LedgerPrincipal
+	LedgerTax
+	// LedgerFee is a standalone commission charge.
+	LedgerFee
+	// LedgerTradeFee duplicates commission already recorded on the trade itself.
+	LedgerTradeFee
+	// LedgerCashFlow moves money in or out of the account.
+	LedgerCashFlow
+	// LedgerSecurityTransfer moves securities in or out of the account.
+	LedgerSecurityTransfer
+	// LedgerCorporateAction splits an instrument, see CorporateAction.
+	LedgerCorporateAction
+)
+
+var ledgerKinds = map[sdk.OperationType]LedgerKind{
+	sdk.BUY:                             LedgerTrade,
+	sdk.OperationTypeBuyCard:            LedgerTrade,
+	sdk.SELL:                            LedgerTrade,
+	sdk.OperationTypeDividend:           LedgerIncome,
+	sdk.OperationTypeCoupon:             LedgerIncome,
+	sdk.OperationTypePartRepayment:      LedgerPrincipal,
+	sdk.OperationTypeRepayment:          LedgerPrincipal,
+	sdk.OperationTypeTax:                LedgerTax,
+	sdk.OperationTypeTaxLucre:           LedgerTax,
+	sdk.OperationTypeTaxDividend:        LedgerTax,
+	sdk.OperationTypeTaxCoupon:          LedgerTax,
+	sdk.OperationTypeTaxBack:            LedgerTax,
+	sdk.OperationTypeExchangeCommission: LedgerFee,
+	sdk.OperationTypeServiceCommission:  LedgerFee,
+	sdk.OperationTypeMarginCommission:   LedgerFee,
+	sdk.OperationTypeOtherCommission:    LedgerFee,
+	sdk.OperationTypeBrokerCommission:   LedgerTradeFee,
+	sdk.OperationTypePayIn:              LedgerCashFlow,
+	sdk.OperationTypePayOut:             LedgerCashFlow,
+	sdk.OperationTypeSecurityIn:         LedgerSecurityTransfer,
+	sdk.OperationTypeSecurityOut:        LedgerSecurityTransfer,
+}
+
+// OperationKind classifies an operation, false for types the portfolio doesn't know about.
+func OperationKind(op sdk.Operation) (LedgerKind, bool) {
+	kind, ok := ledgerKinds[op.OperationType]
+	return kind, ok
+}
+
+// LedgerEntry is a classified operation.
+type LedgerEntry struct {
+	Kind      LedgerKind
+	Ticker    string
+	Operation sdk.Operation
+	// Action is set for LedgerCorporateAction entries only.
+	Action CorporateAction
+}
+
+// Warning is an operation that the portfolio numbers don't account for.
+type Warning struct {
+	Ticker    string        `json:"ticker"`
+	Operation sdk.Operation `json:"operation"`
+	Reason    string        `json:"reason"`
+}
+
+func (w Warning) String() string {
+	instrument := w.Ticker
+	if instrument == "" {
+		instrument = w.Operation.FIGI
+	}
+	if instrument != "" {
+		instrument = " " + instrument
+	}
+	return fmt.Sprintf(
+		"%s %s%s %.2f %s: %s",
+		w.Operation.DateTime.Format("2006/01/02"), w.Operation.OperationType, instrument,
+		w.Operation.Payment, w.Operation.Currency, w.Reason,
+	)
+}
+
+// WarningsSummary lists operations left out of the numbers above.
+func (p Portfolio) WarningsSummary() string {
+	if len(p.Warnings) == 0 {
+		return ""
+	}
+	summary := "Не учтенные операции, данные могут быть неполными:\n"
+	for _, w := range p.Warnings {
+		summary += w.String() + "\n"
+	}
+	return summary
+}
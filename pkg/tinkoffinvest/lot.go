@@ -0,0 +1,87 @@
+package tinkoffinvest
+
+import (
+	"time"
+)
+
+const lotEpsilon = 1e-9
+
+// Lot is an open position acquired by a single operation.
+type Lot struct {
+	Date        time.Time `json:"date"`
+	Quantity    float64   `json:"quantity"`
+	Price       float64   `json:"price"`
+	Fee         float64   `json:"fee"`
+	OperationID string    `json:"operation_id"`
+}
+
+// Cost returns the amount paid for the lot excluding fees.
+func (l Lot) Cost() float64 {
+	return l.Price * l.Quantity
+}
+
+// HoldingPeriod returns how long the lot has been held by the given moment.
+func (l Lot) HoldingPeriod(at time.Time) time.Duration {
+	return at.Sub(l.Date)
+}
+
+// split detaches quantity from the lot, allocating the fee proportionally.
+func (l Lot) split(quantity float64) (part Lot, rest Lot) {
+	part, rest = l, l
+	part.Quantity = quantity
+	rest.Quantity = l.Quantity - quantity
+	if l.Quantity != 0 {
+		part.Fee = l.Fee * quantity / l.Quantity
+	}
+	rest.Fee = l.Fee - part.Fee
+	return part, rest
+}
+
+func lotsQuantity(lots []Lot) (quantity float64) {
+	for _, lot := range lots {
+		quantity += lot.Quantity
+	}
+	return quantity
+}
+
+func lotsCost(lots []Lot) (cost float64) {
+	for _, lot := range lots {
+		cost += lot.Cost()
+	}
+	return cost
+}
+
+// takeLots consumes up to quantity from lots in the order dictated by pick.
+func takeLots(lots []Lot, quantity float64, pick func(lots []Lot) int) (closed []Lot, rest []Lot) {
+	rest = lots
+	for quantity > lotEpsilon && len(rest) > 0 {
+		i := pick(rest)
+		if i < 0 || i >= len(rest) {
+			i = 0
+		}
+		lot := rest[i]
+		if lot.Quantity <= quantity+lotEpsilon {
+			closed = append(closed, lot)
+			quantity -= lot.Quantity
+			rest = append(rest[:i:i], rest[i+1:]...)
+			continue
+		}
+		var part Lot
+		part, lot = lot.split(quantity)
+		closed = append(closed, part)
+		rest[i] = lot
+		quantity = 0
+	}
+	return closed, rest
+}
+
+// ClosedLot is a lot matched by a closing trade.
+type ClosedLot struct {
+	Lot `json:"lot"`
+	// Date, Price and Fee are of the closing trade.
+	Date  time.Time `json:"date"`
+	Price float64   `json:"price"`
+	Fee   float64   `json:"fee"`
+	// Short is set when the lot was opened by a sale and closed by a purchase.
+	Short bool `json:"short"`
+}
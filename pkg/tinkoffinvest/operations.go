@@ -0,0 +1,175 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/pkg/errors"
+)
+
+// DefaultHistoryStart predates any Tinkoff brokerage account, so history starting here is complete.
+var DefaultHistoryStart = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	operationsPageSize = 365 * 24 * time.Hour
+	// operationsOverlap is re-fetched on every sync to pick up late settlements.
+	operationsOverlap = 24 * time.Hour
+)
+
+// OperationsStore caches downloaded operations of an account.
+type OperationsStore interface {
+	// Operations returns stored operations and the moment they are complete up to.
+	Operations(accountID string) ([]sdk.Operation, time.Time, error)
+	// SaveOperations inserts or replaces operations by ID and moves the synced moment.
+	SaveOperations(accountID string, operations []sdk.Operation, syncedTo time.Time) error
+}
+
+// OperationsHistory downloads operations over an arbitrary range page by page.
+func (ti *TinkoffInvest) OperationsHistory(ctx context.Context, accountID string, from, to time.Time) ([]sdk.Operation, error) {
+	operations := make([]sdk.Operation, 0)
+	for from.Before(to) {
+		till := from.Add(operationsPageSize)
+		if till.After(to) {
+			till = to
+		}
+		page, err := ti.Broker.Operations(ctx, accountID, from, till, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get operations from %s to %s", from.Format("2006-01-02"), till.Format("2006-01-02"))
+		}
+		operations = append(operations, page...)
+		from = till
+	}
+	return operations, nil
+}
+
+// AccountOperations returns the whole operations history of an account up to the given moment,
+// downloading only what OperationsStore doesn't have yet.
+func (ti *TinkoffInvest) AccountOperations(ctx context.Context, accountID string, to time.Time) ([]sdk.Operation, error) {
+	from := ti.HistoryStart
+	if from.IsZero() {
+		from = DefaultHistoryStart
+	}
+	var cached []sdk.Operation
+	if ti.OperationsStore != nil {
+		var syncedTo time.Time
+		var err error
+		cached, syncedTo, err = ti.OperationsStore.Operations(accountID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read stored operations")
+		}
+		if syncedTo.After(from) {
+			from = syncedTo.Add(-operationsOverlap)
+		}
+	}
+	fresh, err := ti.OperationsHistory(ctx, accountID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	operations := mergeOperations(cached, fresh)
+	if ti.OperationsStore != nil {
+		syncedTo := to
+		for _, op := range operations {
+			if op.Status == sdk.OperationStatusProgress && op.DateTime.Before(syncedTo) {
+				syncedTo = op.DateTime
+			}
+		}
+		if err := ti.OperationsStore.SaveOperations(accountID, fresh, syncedTo); err != nil {
+			return nil, errors.Wrap(err, "failed to store operations")
+		}
+	}
+	return operations, nil
+}
+
+// OperationKey identifies an operation for deduplication: its ID, or its date, type, instrument and payment
+// for operations the API returns without one.
+func OperationKey(op sdk.Operation) string {
+	if op.ID != "" {
+		return op.ID
+	}
+	return fmt.Sprintf(
+		"%s/%s/%s/%s/%g",
+		op.DateTime.UTC().Format(time.RFC3339Nano), op.OperationType, op.FIGI, op.Currency, op.Payment,
+	)
+}
+
+// mergeOperations combines operations by OperationKey, later ones replacing earlier, ordered by date.
+func mergeOperations(lists ...[]sdk.Operation) []sdk.Operation {
+	byKey := make(map[string]int)
+	merged := make([]sdk.Operation, 0)
+	for _, list := range lists {
+		for _, op := range list {
+			key := OperationKey(op)
+			if i, ok := byKey[key]; ok {
+				merged[i] = op
+				continue
+			}
+			byKey[key] = len(merged)
+			merged = append(merged, op)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].DateTime.Before(merged[j].DateTime)
+	})
+	return merged
+}
+
+// FileOperationsStore keeps operations of each account in a JSON file inside a directory.
+type FileOperationsStore struct {
+	Dir string
+}
+
+type operationsFile struct {
+	SyncedTo   time.Time       `json:"synced_to"`
+	Operations []sdk.Operation `json:"operations"`
+}
+
+func (s FileOperationsStore) path(accountID string) string {
+	if accountID == "" {
+		accountID = "default"
+	}
+	return filepath.Join(s.Dir, "operations-"+filepath.Base(accountID)+".json")
+}
+
+func (s FileOperationsStore) read(accountID string) (operationsFile, error) {
+	var f operationsFile
+	raw, err := os.ReadFile(s.path(accountID))
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, errors.Wrap(err, "failed to read operations file")
+	}
+	return f, errors.Wrap(json.Unmarshal(raw, &f), "failed to decode operations file")
+}
+
+func (s FileOperationsStore) Operations(accountID string) ([]sdk.Operation, time.Time, error) {
+	f, err := s.read(accountID)
+	return f.Operations, f.SyncedTo, err
+}
+
+func (s FileOperationsStore) SaveOperations(accountID string, operations []sdk.Operation, syncedTo time.Time) error {
+	f, err := s.read(accountID)
+	if err != nil {
+		return err
+	}
+	f.Operations = mergeOperations(f.Operations, operations)
+	f.SyncedTo = syncedTo
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode operations file")
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create operations directory")
+	}
+	tmp := s.path(accountID) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return errors.Wrap(err, "failed to write operations file")
+	}
+	return errors.Wrap(os.Rename(tmp, s.path(accountID)), "failed to replace operations file")
+}
@@ -0,0 +1,103 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// operationsBroker serves operations by date and records the ranges requested.
+type operationsBroker struct {
+	Broker
+	operations []sdk.Operation
+	requests   [][2]time.Time
+}
+
+func (b *operationsBroker) Operations(_ context.Context, _ string, from, to time.Time, _ string) ([]sdk.Operation, error) {
+	b.requests = append(b.requests, [2]time.Time{from, to})
+	page := make([]sdk.Operation, 0)
+	for _, op := range b.operations {
+		if !op.DateTime.Before(from) && op.DateTime.Before(to) {
+			page = append(page, op)
+		}
+	}
+	return page, nil
+}
+
+func TestAccountOperations(t *testing.T) {
+	pending := trade("3", sdk.BUY, 735, 1, 100, -1)
+	pending.Status = sdk.OperationStatusProgress
+	broker := &operationsBroker{operations: []sdk.Operation{
+		trade("1", sdk.BUY, 0, 10, 100, -1),
+		trade("2", sdk.SELL, 400, 5, 120, -1),
+		pending,
+	}}
+	ti := &TinkoffInvest{
+		Broker:          broker,
+		HistoryStart:    testStart,
+		OperationsStore: FileOperationsStore{Dir: t.TempDir()},
+	}
+	ctx := context.Background()
+
+	operations, err := ti.AccountOperations(ctx, "", testStart.AddDate(0, 0, 740))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 3 {
+		t.Fatalf("got %d operations, want 3: %+v", len(operations), operations)
+	}
+	// two full years and the rest
+	if len(broker.requests) != 3 || !broker.requests[0][0].Equal(testStart) {
+		t.Errorf("requests = %v, want 3 pages from %v", broker.requests, testStart)
+	}
+
+	// the next sync starts before the pending operation and picks up its settlement
+	broker.operations[2].Status = sdk.OperationStatusDone
+	broker.requests = nil
+	operations, err = ti.AccountOperations(ctx, "", testStart.AddDate(0, 0, 745))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 3 {
+		t.Fatalf("got %d operations, want 3: %+v", len(operations), operations)
+	}
+	if operations[2].Status != sdk.OperationStatusDone {
+		t.Errorf("operation 3 status = %s, want the settled one", operations[2].Status)
+	}
+	if from := pending.DateTime.Add(-operationsOverlap); len(broker.requests) != 1 || !broker.requests[0][0].Equal(from) {
+		t.Errorf("requests = %v, want one page from %v", broker.requests, from)
+	}
+}
+
+func TestMergeOperations(t *testing.T) {
+	fee := func(day int, payment float64) sdk.Operation {
+		return sdk.Operation{
+			Status:        sdk.OperationStatusDone,
+			OperationType: sdk.OperationTypeServiceCommission,
+			DateTime:      testStart.AddDate(0, 0, day),
+			Currency:      sdk.RUB,
+			Payment:       payment,
+		}
+	}
+	buy := trade("1", sdk.BUY, 0, 10, 100, -1)
+	pending := buy
+	pending.Status = sdk.OperationStatusProgress
+
+	cached := []sdk.Operation{pending, fee(1, -99), fee(2, -99)}
+	// the sync overlap returns the last fee again along with a new one of a different amount
+	fresh := []sdk.Operation{buy, fee(2, -99), fee(2, -290)}
+	merged := mergeOperations(cached, fresh)
+	if len(merged) != 4 {
+		t.Fatalf("merged %d operations, want 4: %+v", len(merged), merged)
+	}
+	if merged[0].Status != sdk.OperationStatusDone {
+		t.Errorf("operation 1 status = %s, want the fresh one", merged[0].Status)
+	}
+	for i, want := range []float64{-99, -99, -290} {
+		if got := merged[i+1].Payment; got != want {
+			t.Errorf("fee %d payment = %v, want %v", i, got, want)
+		}
+	}
+}
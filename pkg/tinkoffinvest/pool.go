@@ -0,0 +1,160 @@
+package tinkoffinvest
+
+import (
+	"sync"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/rs/zerolog"
+)
+
+// MaxConnectionSubscriptions is how many streams the API allows on one websocket connection.
+const MaxConnectionSubscriptions = 300
+
+// StreamingPool shares websocket connections between subscribers using the same API key,
+// spreading streams over more connections when one reaches the subscription limit.
+type StreamingPool struct {
+	mu    sync.Mutex
+	log   zerolog.Logger
+	limit int
+	// url is the websocket endpoint of new connections, overridden by tests
+	url    string
+	shards map[string][]*poolShard
+}
+
+type poolShard struct {
+	client *StreamingClient
+	// streams counts subscribers of every stream opened on the connection
+	streams map[string]int
+}
+
+// PoolConnection describes one connection of the pool.
+type PoolConnection struct {
+	APIKey        string
+	Shard         int
+	Subscriptions int
+	State         StreamingState
+}
+
+func NewStreamingPool(log zerolog.Logger) *StreamingPool {
+	return newStreamingPool(sdk.StreamingApiURL, MaxConnectionSubscriptions, log)
+}
+
+func newStreamingPool(url string, limit int, log zerolog.Logger) *StreamingPool {
+	return &StreamingPool{
+		log:    log,
+		limit:  limit,
+		url:    url,
+		shards: make(map[string][]*poolShard),
+	}
+}
+
+// Subscribe streams candles like StreamingClient.Subscribe, on a connection of apiKey that already has
+// the stream or has room for it.
+func (p *StreamingPool) Subscribe(apiKey, figi string, interval sdk.CandleInterval) (<-chan CandleEvent, func()) {
+	key := candlesKey(figi, interval)
+	shard := p.acquire(apiKey, key)
+	events, cancel := shard.client.Subscribe(figi, interval)
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			cancel()
+			p.release(apiKey, shard, key)
+		})
+	}
+}
+
+// SubscribeOrderbook streams order books like StreamingClient.SubscribeOrderbook.
+func (p *StreamingPool) SubscribeOrderbook(apiKey, figi string, depth int) (<-chan OrderbookEvent, func()) {
+	key := orderbookKey(figi, depth)
+	shard := p.acquire(apiKey, key)
+	events, cancel := shard.client.SubscribeOrderbook(figi, depth)
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			cancel()
+			p.release(apiKey, shard, key)
+		})
+	}
+}
+
+// SubscribeInstrumentInfo streams instrument info like StreamingClient.SubscribeInstrumentInfo.
+func (p *StreamingPool) SubscribeInstrumentInfo(apiKey, figi string) (<-chan InstrumentInfoEvent, func()) {
+	key := instrumentInfoKey(figi)
+	shard := p.acquire(apiKey, key)
+	events, cancel := shard.client.SubscribeInstrumentInfo(figi)
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			cancel()
+			p.release(apiKey, shard, key)
+		})
+	}
+}
+
+// acquire picks the connection for a stream and counts the new subscriber on it.
+func (p *StreamingPool) acquire(apiKey, key string) *poolShard {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var shard *poolShard
+	for _, s := range p.shards[apiKey] {
+		if _, ok := s.streams[key]; ok {
+			shard = s
+			break
+		}
+		if shard == nil && len(s.streams) < p.limit {
+			shard = s
+		}
+	}
+	if shard == nil {
+		shard = &poolShard{
+			client: newStreamingClient(
+				apiKey, p.url, p.log.With().Int("shard", len(p.shards[apiKey])).Logger(),
+			),
+			streams: make(map[string]int),
+		}
+		p.shards[apiKey] = append(p.shards[apiKey], shard)
+	}
+	shard.streams[key]++
+	return shard
+}
+
+// release forgets a subscriber and closes the connection once nothing is streamed over it.
+func (p *StreamingPool) release(apiKey string, shard *poolShard, key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if shard.streams[key]--; shard.streams[key] <= 0 {
+		delete(shard.streams, key)
+	}
+	if len(shard.streams) > 0 {
+		return
+	}
+	shards := p.shards[apiKey]
+	for i, s := range shards {
+		if s == shard {
+			p.shards[apiKey] = append(shards[:i], shards[i+1:]...)
+			break
+		}
+	}
+	if len(p.shards[apiKey]) == 0 {
+		delete(p.shards, apiKey)
+	}
+	go shard.client.StreamingClientClose()
+}
+
+// Connections lists open connections with the number of streams and health of each.
+func (p *StreamingPool) Connections() []PoolConnection {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	connections := make([]PoolConnection, 0)
+	for apiKey, shards := range p.shards {
+		for i, shard := range shards {
+			connections = append(connections, PoolConnection{
+				APIKey:        apiKey,
+				Shard:         i,
+				Subscriptions: len(shard.streams),
+				State:         shard.client.State(),
+			})
+		}
+	}
+	return connections
+}
@@ -0,0 +1,77 @@
+package tinkoffinvest
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/rs/zerolog"
+)
+
+// poolSubscriptions lists the number of streams on every connection of the pool.
+func poolSubscriptions(p *StreamingPool) []int {
+	subscriptions := make([]int, 0)
+	for _, conn := range p.Connections() {
+		subscriptions = append(subscriptions, conn.Subscriptions)
+	}
+	return subscriptions
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamingPoolShards(t *testing.T) {
+	fake := newFakeStreaming(t)
+	p := newStreamingPool(fake.url(), 2, zerolog.Nop())
+	const interval = sdk.CandleInterval5Min
+
+	_, cancelFirst := p.Subscribe("token", "FIGI1", interval)
+	fake.expect(t, "candle:subscribe FIGI1")
+	fake.conn(t)
+	_, cancelSecond := p.Subscribe("token", "FIGI2", interval)
+	defer cancelSecond()
+	fake.expect(t, "candle:subscribe FIGI2")
+
+	// the first connection is full, the third stream opens another one
+	_, cancelThird := p.Subscribe("token", "FIGI3", interval)
+	fake.expect(t, "candle:subscribe FIGI3")
+	fake.conn(t)
+	if got := poolSubscriptions(p); !equalInts(got, []int{2, 1}) {
+		t.Errorf("subscriptions = %v, want [2 1]", got)
+	}
+
+	// the slot freed on the first connection is taken before the second one
+	cancelFirst()
+	fake.expect(t, "candle:unsubscribe FIGI1")
+	_, cancelFourth := p.Subscribe("token", "FIGI4", interval)
+	defer cancelFourth()
+	fake.expect(t, "candle:subscribe FIGI4")
+	select {
+	case <-fake.conns:
+		t.Error("a connection is opened with a free slot")
+	default:
+	}
+	if got := poolSubscriptions(p); !equalInts(got, []int{2, 1}) {
+		t.Errorf("subscriptions = %v, want [2 1]", got)
+	}
+
+	// the connection left empty is dropped at once and closed in the background
+	cancelThird()
+	if got := poolSubscriptions(p); !equalInts(got, []int{2}) {
+		t.Errorf("subscriptions = %v, want [2]", got)
+	}
+	select {
+	case <-fake.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the empty connection to close")
+	}
+}
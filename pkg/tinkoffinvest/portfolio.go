@@ -13,13 +13,21 @@ import (
 )
 
 type Portfolio struct {
-	TotalFee             map[Currency]float64
-	TotalProfit          map[Currency]float64
-	TotalPotentialProfit map[Currency]float64
-	TotalDividend        map[Currency]float64
-	TotalTax             map[Currency]float64
-	TotalPosition        map[Currency]float64
-	Items                []PortfolioItem
+	TotalFee             map[Currency]float64 `json:"total_fee"`
+	TotalProfit          map[Currency]float64 `json:"total_profit"`
+	TotalPotentialProfit map[Currency]float64 `json:"total_potential_profit"`
+	TotalDividend        map[Currency]float64 `json:"total_dividend"`
+	TotalCoupon          map[Currency]float64 `json:"total_coupon"`
+	TotalTax             map[Currency]float64 `json:"total_tax"`
+	TotalPosition        map[Currency]float64 `json:"total_position"`
+	// FXProfit is realized profit in rubles on buying and selling each currency.
+	FXProfit     map[Currency]float64 `json:"fx_profit"`
+	BaseCurrency Currency             `json:"base_currency"`
+	Rates        Rates                `json:"rates"`
+	Returns      map[Currency]Returns `json:"returns"`
+	Items        []PortfolioItem      `json:"items"`
+	// Warnings lists operations that couldn't be accounted for.
+	Warnings []Warning `json:"warnings"`
 }
 
 func (p Portfolio) Summary() (summary string) {
@@ -27,11 +35,15 @@ func (p Portfolio) Summary() (summary string) {
 		if currency.String() == "" {
 			continue
 		}
+		var coupons string
+		if p.TotalCoupon[currency] != 0 {
+			coupons = fmt.Sprintf(", куп %.2f", p.TotalCoupon[currency])
+		}
 		summary += fmt.Sprintf(
-			"\n%s полученная прибыль: %s (див %.2f, ком %.2f, налог %.2f)\n",
+			"\n%s полученная прибыль: %s (див %.2f%s, ком %.2f, налог %.2f)\n",
 			currency.String(),
 			formatMoney(currency, p.TotalProfit[currency]),
-			p.TotalDividend[currency], -1*p.TotalFee[currency], p.TotalTax[currency],
+			p.TotalDividend[currency], coupons, -1*p.TotalFee[currency], p.TotalTax[currency],
 		)
 		summary += fmt.Sprintf(
 			"%s вложений: %s%.2f\n",
@@ -49,48 +61,177 @@ func (p Portfolio) Summary() (summary string) {
 			numSign(profitPc), profitPc,
 		)
 	}
+	summary += p.fxSummary()
+	if returns := p.ReturnsSummary(); returns != "" {
+		summary += returns
+		if !p.hasTWR() {
+			summary += "TWR рассчитывается по истории цен, см. /returns\n"
+		}
+	}
+	summary += p.consolidatedSummary()
 	return
 }
 
 type PortfolioItem struct {
-	Ticker          string
-	FIGI            string
-	Currency        Currency
-	Profit          float64
-	Tax             float64
-	Dividends       float64
-	Fee             float64
-	Holdings        float64
-	ExpectedYield   float64
-	ExpectedYieldPc float64
-	Trades          []Trade
-	LongPositions   []float64
-	ShortPositions  []float64
+	Ticker         string             `json:"ticker"`
+	FIGI           string             `json:"figi"`
+	InstrumentType sdk.InstrumentType `json:"instrument_type"`
+	Currency       Currency           `json:"currency"`
+	Profit         float64            `json:"profit"`
+	Tax            float64            `json:"tax"`
+	Dividends      float64            `json:"dividends"`
+	Coupons        float64            `json:"coupons"`
+	// AccruedInterest is НКД received on bond sales net of НКД paid on purchases.
+	AccruedInterest float64 `json:"accrued_interest"`
+	Amortization    float64 `json:"amortization"`
+	// Invested is the total clean value of purchases.
+	Invested        float64 `json:"invested"`
+	Fee             float64 `json:"fee"`
+	Holdings        float64 `json:"holdings"`
+	ExpectedYield   float64 `json:"expected_yield"`
+	ExpectedYieldPc float64 `json:"expected_yield_pc"`
+	Trades          []Trade `json:"trades"`
+	LongPositions   []Lot   `json:"long_positions"`
+	ShortPositions  []Lot   `json:"short_positions"`
 }
 
 func (item PortfolioItem) TotalProfit() float64 {
-	return item.Profit + item.Dividends + item.Fee + item.Tax
+	return item.Profit + item.Dividends + item.Coupons + item.AccruedInterest + item.Fee + item.Tax
+}
+
+// TradedCurrency returns the currency bought and sold by a currency instrument item.
+func (item PortfolioItem) TradedCurrency() (Currency, bool) {
+	if item.InstrumentType != sdk.InstrumentTypeCurrency {
+		return "", false
+	}
+	currency, ok := currencyTickers[item.Ticker]
+	return currency, ok
+}
+
+// Quantity returns the number of units held, negative for a short position.
+func (item PortfolioItem) Quantity() float64 {
+	return lotsQuantity(item.LongPositions) - lotsQuantity(item.ShortPositions)
+}
+
+// applyTrades closes lots on the opposite side of op and opens new lots with whatever is left.
+func (item *PortfolioItem) applyTrades(op sdk.Operation, costBasis CostBasis) {
+	if len(op.Trades) == 0 {
+		return
+	}
+	isBuy := op.OperationType != sdk.SELL
+	var totalQuantity float64
+	for _, trade := range op.Trades {
+		totalQuantity += float64(trade.Quantity)
+	}
+	result := Trade{Date: op.DateTime, Type: "продажа"}
+	if isBuy {
+		result.Type = "закрытие шорта"
+	}
+	var profitPc, pricedQuantity, holdingPeriod float64
+	for _, trade := range op.Trades {
+		quantity := float64(trade.Quantity)
+		if quantity <= 0 {
+			continue
+		}
+		fee := op.Commission.Value * quantity / totalQuantity
+		var closed []Lot
+		if isBuy {
+			closed, item.ShortPositions = costBasis.Take(item.ShortPositions, quantity, op)
+		} else {
+			closed, item.LongPositions = costBasis.Take(item.LongPositions, quantity, op)
+		}
+		for _, lot := range closed {
+			profit := (trade.Price - lot.Price) * lot.Quantity
+			if isBuy {
+				profit = -profit
+			}
+			// lots transferred in without a purchase price are left out of profit, see /transfer
+			if lot.Price > 0 {
+				if trade.Price > 0 {
+					pc := trade.Price*100/lot.Price - 100
+					if isBuy {
+						pc = lot.Price*100/trade.Price - 100
+					}
+					profitPc += pc * lot.Quantity
+					pricedQuantity += lot.Quantity
+				}
+				result.Profit += profit
+			}
+			result.Quantity += lot.Quantity
+			result.Fee += lot.Fee
+			holdingPeriod += float64(lot.HoldingPeriod(op.DateTime)) * lot.Quantity
+			result.Closed = append(result.Closed, ClosedLot{
+				Lot:   lot,
+				Date:  op.DateTime,
+				Price: trade.Price,
+				Fee:   fee * lot.Quantity / quantity,
+				Short: isBuy,
+			})
+		}
+		closedQuantity := lotsQuantity(closed)
+		result.Fee += fee * closedQuantity / quantity
+		if left := quantity - closedQuantity; left > lotEpsilon {
+			lot := Lot{
+				Date:        op.DateTime,
+				Quantity:    left,
+				Price:       trade.Price,
+				Fee:         fee * left / quantity,
+				OperationID: op.ID,
+			}
+			if isBuy {
+				item.LongPositions = append(item.LongPositions, lot)
+			} else {
+				item.ShortPositions = append(item.ShortPositions, lot)
+			}
+		}
+	}
+	if result.Quantity > 0 {
+		if pricedQuantity > 0 {
+			result.ProfitPc = profitPc / pricedQuantity
+		}
+		result.HoldingPeriod = time.Duration(holdingPeriod / result.Quantity)
+		item.Profit += result.Profit
+		item.Trades = append(item.Trades, result)
+	}
 }
 
 func (item PortfolioItem) Details() string {
 	var details string
-	details += fmt.Sprintf("*%s* \\(%s\\)\n```\n", item.Ticker, item.FIGI)
+	title := item.Ticker
+	if currency, ok := item.TradedCurrency(); ok {
+		title = currency.String()
+	}
+	details += fmt.Sprintf("*%s* \\(%s\\)\n```\n", title, item.FIGI)
 
 	for _, trade := range item.Trades {
 		details += fmt.Sprintf(
-			"%s %s (%s%.2f%%)\n",
+			"%s %s (%s%.2f%%) %s %dдн\n",
 			trade.Date.Format("2006/01/02"),
 			formatMoney(item.Currency, trade.Profit), numSign(trade.ProfitPc), trade.ProfitPc,
+			item.formatQuantity(trade.Quantity), holdingDays(trade.HoldingPeriod),
 		)
 	}
 	if len(item.Trades) > 0 {
 		details += "\n"
 	}
+	now := time.Now()
+	for _, lot := range item.LongPositions {
+		details += item.formatLot(lot, 1, now)
+	}
+	for _, lot := range item.ShortPositions {
+		details += item.formatLot(lot, -1, now)
+	}
+	if len(item.LongPositions)+len(item.ShortPositions) > 0 {
+		details += "\n"
+	}
 	details += fmt.Sprintf("Получено: %s", formatMoney(item.Currency, item.TotalProfit()))
 	profitDetails := make([]string, 0)
 	if item.Dividends != 0 {
 		profitDetails = append(profitDetails, fmt.Sprintf("див %s", formatMoney(item.Currency, item.Dividends)))
 	}
+	if item.Coupons != 0 {
+		profitDetails = append(profitDetails, fmt.Sprintf("куп %s", formatMoney(item.Currency, item.Coupons)))
+	}
 	if item.Fee != 0 {
 		profitDetails = append(profitDetails, fmt.Sprintf("ком %s", formatMoney(item.Currency, item.Fee)))
 	}
@@ -110,12 +251,13 @@ func (item PortfolioItem) Details() string {
 			numSign(item.ExpectedYieldPc), item.ExpectedYieldPc,
 		)
 	}
+	details += item.bondDetails()
 	details += "```\n"
 	return details
 }
 
 func (ti *TinkoffInvest) PortfolioPositions(ctx context.Context, accountID string) (map[string]sdk.PositionBalance, error) {
-	allPositions, err := ti.RestClient.PositionsPortfolio(ctx, accountID)
+	allPositions, err := ti.Broker.PositionsPortfolio(ctx, accountID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get portfolio positions")
 	}
@@ -128,80 +270,219 @@ func (ti *TinkoffInvest) PortfolioPositions(ctx context.Context, accountID strin
 	return portfolio, nil
 }
 
-func (ti *TinkoffInvest) Portfolio(ctx context.Context, accountID string) (Portfolio, error) {
-	p := Portfolio{
+// PortfolioOptions tunes how Portfolio matches operations into realized profit.
+type PortfolioOptions struct {
+	// CostBasis defaults to FIFO.
+	CostBasis CostBasis
+	// BaseCurrency is used for consolidated totals, RUB by default.
+	BaseCurrency Currency
+	// TransferPrices holds purchase prices by FIGI for securities transferred in from another broker.
+	TransferPrices map[string]float64
+	// CorporateActions are applied to operations made before each of them.
+	CorporateActions []CorporateAction
+}
+
+// Instruments is the instrument catalog operations are resolved against.
+type Instruments struct {
+	Stocks     []sdk.Instrument `json:"stocks"`
+	Bonds      []sdk.Instrument `json:"bonds"`
+	ETFs       []sdk.Instrument `json:"etfs"`
+	Currencies []sdk.Instrument `json:"currencies"`
+}
+
+// PortfolioData is everything BuildPortfolio needs from the broker, so it can be recorded and replayed.
+type PortfolioData struct {
+	Operations  []sdk.Operation                `json:"operations"`
+	Instruments Instruments                    `json:"instruments"`
+	Positions   map[string]sdk.PositionBalance `json:"positions"`
+	// Quotes holds last prices by FIGI for positions the broker reports without an average price.
+	Quotes map[string]float64 `json:"quotes"`
+	Rates  Rates              `json:"rates"`
+	// Balances holds free cash by currency.
+	Balances map[Currency]float64 `json:"balances"`
+	// Prices is optional daily history used for time-weighted returns.
+	Prices PriceHistory `json:"prices,omitempty"`
+	// FaceValues is optional current face value by FIGI of held bonds, it lets forecasts stop at redemption.
+	FaceValues map[string]float64 `json:"face_values,omitempty"`
+	// Time is the moment the data was captured, now if zero.
+	Time time.Time `json:"time"`
+}
+
+// Instruments returns the instrument catalog from InstrumentsCache when it is filled, downloading it otherwise.
+func (ti *TinkoffInvest) Instruments(ctx context.Context) (Instruments, error) {
+	var instruments Instruments
+	var err error
+	if ti.InstrumentsCache != nil {
+		instruments, err = ti.InstrumentsCache.Instruments(ctx)
+		if err == nil && len(instruments.Stocks) > 0 && len(instruments.Currencies) > 0 {
+			return instruments, nil
+		}
+	}
+
+	instruments.Stocks, err = ti.Broker.Stocks(ctx)
+	if err != nil || len(instruments.Stocks) == 0 {
+		return instruments, errors.Wrap(err, "failed to get stocks")
+	}
+	instruments.Bonds, err = ti.Broker.Bonds(ctx)
+	if err != nil || len(instruments.Bonds) == 0 {
+		return instruments, errors.Wrap(err, "failed to get bonds")
+	}
+	instruments.ETFs, err = ti.Broker.ETFs(ctx)
+	if err != nil || len(instruments.ETFs) == 0 {
+		return instruments, errors.Wrap(err, "failed to get etfs")
+	}
+	instruments.Currencies, err = ti.Broker.Currencies(ctx)
+	if err != nil {
+		return instruments, errors.Wrap(err, "failed to get currencies")
+	}
+	return instruments, nil
+}
+
+func (ti *TinkoffInvest) PortfolioData(ctx context.Context, accountID string) (PortfolioData, error) {
+	data := PortfolioData{Time: time.Now()}
+	var err error
+
+	data.Positions, err = ti.PortfolioPositions(ctx, accountID)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to get portfolio positions")
+	}
+
+	data.Instruments, err = ti.Instruments(ctx)
+	if err != nil {
+		return data, err
+	}
+	data.Operations, err = ti.AccountOperations(ctx, accountID, data.Time)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to get list of operations")
+	}
+	balances, err := ti.Broker.CurrenciesPortfolio(ctx, accountID)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to get currency balances")
+	}
+	data.Balances = make(map[Currency]float64)
+	for _, balance := range balances {
+		data.Balances[Currency(balance.Currency)] += balance.Balance
+	}
+
+	bonds := make(map[string]struct{})
+	for _, bond := range data.Instruments.Bonds {
+		bonds[bond.FIGI] = struct{}{}
+	}
+	data.Quotes = make(map[string]float64)
+	for _, position := range data.Positions {
+		if _, ok := bonds[position.FIGI]; ok || position.InstrumentType == sdk.InstrumentTypeCurrency {
+			continue
+		}
+		if position.Balance <= 0 || position.AveragePositionPrice.Value != 0 {
+			continue
+		}
+		orderbook, err := ti.Broker.Orderbook(ctx, 1, position.FIGI)
+		if err != nil {
+			return data, errors.Wrapf(err, "failed to get order book for %s", position.Ticker)
+		}
+		data.Quotes[position.FIGI] = orderbook.LastPrice
+	}
+	data.Rates = make(Rates)
+	for _, instrument := range data.Instruments.Currencies {
+		currency, ok := currencyTickers[instrument.Ticker]
+		if !ok {
+			continue
+		}
+		orderbook, err := ti.Broker.Orderbook(ctx, 1, instrument.FIGI)
+		if err != nil {
+			return data, errors.Wrapf(err, "failed to get order book for %s", instrument.Ticker)
+		}
+		data.Rates[currency] = orderbook.LastPrice
+		if data.Rates[currency] == 0 {
+			data.Rates[currency] = orderbook.ClosePrice
+		}
+	}
+	return data, nil
+}
+
+// Portfolio builds the portfolio of an account without price history, so its returns have no TWR.
+// Fill PortfolioData.Prices with PriceHistory and call BuildPortfolio to get it.
+func (ti *TinkoffInvest) Portfolio(ctx context.Context, accountID string, opts PortfolioOptions) (Portfolio, error) {
+	data, err := ti.PortfolioData(ctx, accountID)
+	if err != nil {
+		return newPortfolio(), err
+	}
+	return BuildPortfolio(data, opts), nil
+}
+
+func newPortfolio() Portfolio {
+	return Portfolio{
 		TotalFee:             make(map[Currency]float64),
 		TotalProfit:          make(map[Currency]float64),
 		TotalPotentialProfit: make(map[Currency]float64),
 		TotalDividend:        make(map[Currency]float64),
+		TotalCoupon:          make(map[Currency]float64),
 		TotalTax:             make(map[Currency]float64),
 		TotalPosition:        make(map[Currency]float64),
+		FXProfit:             make(map[Currency]float64),
+		Returns:              make(map[Currency]Returns),
+		BaseCurrency:         RUB,
+		Rates:                make(Rates),
 		Items:                make([]PortfolioItem, 0),
+		Warnings:             make([]Warning, 0),
 	}
+}
 
-	portfolio, err := ti.PortfolioPositions(ctx, accountID)
-	if err != nil {
-		return p, errors.Wrap(err, "failed to get portfolio positions")
-	}
-
-	allStocks, err := ti.RestClient.Stocks(ctx)
-	if err != nil || len(allStocks) == 0 {
-		return p, errors.Wrap(err, "failed to get stocks")
+// BuildPortfolio replays operations into realized and potential profit without touching the API.
+func BuildPortfolio(data PortfolioData, opts PortfolioOptions) Portfolio {
+	costBasis := opts.CostBasis
+	if costBasis == nil {
+		costBasis = FIFO
 	}
-	allBonds, err := ti.RestClient.Bonds(ctx)
-	if err != nil || len(allBonds) == 0 {
-		return p, errors.Wrap(err, "failed to get bonds")
+	p := newPortfolio()
+	if opts.BaseCurrency != "" {
+		p.BaseCurrency = opts.BaseCurrency
 	}
-	allEtfs, err := ti.RestClient.ETFs(ctx)
-	if err != nil || len(allEtfs) == 0 {
-		return p, errors.Wrap(err, "failed to get etfs")
+	if data.Rates != nil {
+		p.Rates = data.Rates
 	}
+
 	stocks := make(map[string]sdk.Instrument)
-	bonds := make(map[string]struct{})
+	types := make(map[string]sdk.InstrumentType)
 	tickers := make(map[string]string)
-	for _, stock := range allStocks {
-		stocks[stock.FIGI] = stock
-		tickers[stock.Ticker] = stock.FIGI
-	}
-	for _, stock := range allBonds {
-		stocks[stock.FIGI] = stock
-		tickers[stock.Ticker] = stock.FIGI
-		bonds[stock.FIGI] = struct{}{}
-	}
-	for _, stock := range allEtfs {
-		stocks[stock.FIGI] = stock
-		tickers[stock.Ticker] = stock.FIGI
-	}
-	rawOperations, err := ti.RestClient.Operations(ctx, accountID, time.Now().Add(-1*5*24*365*time.Hour), time.Now(), "")
-	if err != nil {
-		return p, errors.Wrap(err, "failed to get list of operations")
+	for instrumentType, instruments := range map[sdk.InstrumentType][]sdk.Instrument{
+		sdk.InstrumentTypeStock:    data.Instruments.Stocks,
+		sdk.InstrumentTypeBond:     data.Instruments.Bonds,
+		sdk.InstrumentTypeEtf:      data.Instruments.ETFs,
+		sdk.InstrumentTypeCurrency: data.Instruments.Currencies,
+	} {
+		for _, stock := range instruments {
+			stocks[stock.FIGI] = stock
+			types[stock.FIGI] = instrumentType
+			tickers[stock.Ticker] = stock.FIGI
+		}
 	}
-	operations := make(map[string][]sdk.Operation)
-	for _, rawOp := range rawOperations {
-		if rawOp.Status != sdk.OperationStatusDone || rawOp.InstrumentType == sdk.InstrumentTypeCurrency {
+	actions := newCorporateActions(opts.CorporateActions)
+	operations := make(map[string][]LedgerEntry)
+	for _, rawOp := range data.Operations {
+		if rawOp.Status != sdk.OperationStatusDone {
 			continue
 		}
+		if rawOp.FIGI != "" {
+			rawOp.FIGI = actions.resolve(rawOp.FIGI, rawOp.DateTime)
+		}
 		var ticker string
 		if stock, ok := stocks[rawOp.FIGI]; ok {
 			ticker = stock.Ticker
 		}
-		ops, ok := operations[ticker]
-		if !ok {
-			ops = make([]sdk.Operation, 0)
-		}
-		switch rawOp.OperationType {
-		case sdk.BUY, sdk.OperationTypeBuyCard, sdk.SELL, sdk.OperationTypeDividend:
-			ops = append(ops, rawOp)
-		case sdk.OperationTypeTax, sdk.OperationTypeTaxDividend, sdk.OperationTypeTaxBack:
-			ops = append(ops, rawOp)
-		case sdk.OperationTypeBrokerCommission, sdk.OperationTypePayIn, sdk.OperationTypePayOut:
-			// ignore
+		kind, ok := OperationKind(rawOp)
+		switch {
+		case !ok:
+			p.Warnings = append(p.Warnings, Warning{Ticker: ticker, Operation: rawOp, Reason: "неизвестный тип операции"})
 			continue
-		default:
-			fmt.Printf("UNKNOWN OPERATION TYPE: %s: %+v\n", stocks[rawOp.FIGI].Ticker, rawOp)
+		case kind == LedgerTradeFee, kind == LedgerCashFlow:
 			continue
+		case kind == LedgerSecurityTransfer && rawOp.OperationType == sdk.OperationTypeSecurityIn:
+			if opts.TransferPrices[rawOp.FIGI] <= 0 {
+				p.Warnings = append(p.Warnings, Warning{Ticker: ticker, Operation: rawOp, Reason: "не задана цена покупки, см. /transfer"})
+			}
 		}
-		operations[ticker] = ops
+		operations[ticker] = append(operations[ticker], LedgerEntry{Kind: kind, Ticker: ticker, Operation: rawOp})
 	}
 	allInstruments := make([]string, 0, len(operations))
 	for ticker := range operations {
@@ -213,120 +494,155 @@ func (ti *TinkoffInvest) Portfolio(ctx context.Context, accountID string) (Portf
 		item := PortfolioItem{
 			Ticker:         ticker,
 			FIGI:           tickers[ticker],
+			InstrumentType: types[tickers[ticker]],
 			Currency:       Currency(stocks[tickers[ticker]].Currency),
 			Trades:         make([]Trade, 0),
-			LongPositions:  make([]float64, 0),
-			ShortPositions: make([]float64, 0),
+			LongPositions:  make([]Lot, 0),
+			ShortPositions: make([]Lot, 0),
 		}
-		ops := operations[ticker]
-		sort.Slice(ops, func(i, j int) bool {
-			return ops[i].DateTime.Before(ops[j].DateTime)
+		itemCostBasis := costBasis
+		if item.InstrumentType == sdk.InstrumentTypeCurrency {
+			// currency conversions are always matched FIFO against the ruble cost of earlier purchases
+			itemCostBasis = FIFO
+		}
+		entries := append(operations[ticker], actions.entries(item.FIGI, ticker)...)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Operation.DateTime.Before(entries[j].Operation.DateTime)
 		})
 
-		for _, op := range ops {
+		for _, entry := range entries {
+			op := entry.Operation
 			item.Fee += op.Commission.Value
-			switch op.OperationType {
-			case sdk.BUY, sdk.OperationTypeBuyCard:
-				if len(op.Trades) == 0 {
-					continue
+			switch entry.Kind {
+			case LedgerTrade:
+				if op.OperationType != sdk.SELL {
+					item.Invested += tradesValue(op)
 				}
-				var profitPc, profit float64
-				var positionsClosed int
-				for _, trade := range op.Trades {
-					for i := 0; i < trade.Quantity; i++ {
-						if len(item.ShortPositions) > 0 {
-							positionsClosed++
-							pos := item.ShortPositions[0]
-							item.ShortPositions = item.ShortPositions[1:]
-							profitPc += pos*100/trade.Price - 100
-							item.Profit += pos - trade.Price
-							profit += pos - trade.Price
-						} else {
-							item.LongPositions = append(item.LongPositions, trade.Price)
-						}
-					}
-				}
-				if positionsClosed > 0 {
-					item.Trades = append(item.Trades, Trade{
-						Date:     op.DateTime,
-						Type:     "закрытие шорта",
-						ProfitPc: profitPc / float64(positionsClosed),
-						Profit:   profit,
-					})
+				item.applyAccruedInterest(op)
+				item.applyTrades(op, itemCostBasis)
+			case LedgerIncome:
+				if op.OperationType == sdk.OperationTypeCoupon {
+					item.Coupons += op.Payment
+				} else {
+					item.Dividends += op.Payment
 				}
-			case sdk.SELL:
-				if len(op.Trades) == 0 {
-					continue
-				}
-				var profitPc, profit float64
-				var positionsClosed int
-				for _, trade := range op.Trades {
-					for i := 0; i < trade.Quantity; i++ {
-						if len(item.LongPositions) == 0 {
-							item.ShortPositions = append(item.ShortPositions, trade.Price)
-						} else {
-							positionsClosed++
-							pos := item.LongPositions[0]
-							item.LongPositions = item.LongPositions[1:]
-							profitPc += trade.Price*100/pos - 100
-							item.Profit += trade.Price - pos
-							profit += trade.Price - pos
-						}
-					}
+			case LedgerPrincipal:
+				if op.OperationType == sdk.OperationTypeRepayment {
+					item.redeem(op, itemCostBasis)
+				} else {
+					item.amortize(op)
 				}
-				if positionsClosed > 0 {
-					item.Trades = append(item.Trades, Trade{
-						Date:     op.DateTime,
-						Type:     "продажа",
-						ProfitPc: profitPc / float64(positionsClosed),
-						Profit:   profit,
-					})
-				}
-			case sdk.OperationTypeDividend:
-				item.Dividends += op.Payment
-			case sdk.OperationTypeTax, sdk.OperationTypeTaxBack, sdk.OperationTypeTaxDividend:
+			case LedgerTax:
 				p.TotalTax[Currency(op.Currency)] -= op.Payment
 				if ticker != "" {
 					item.Profit += op.Payment
 					item.Tax += op.Payment
 				}
+			case LedgerCorporateAction:
+				item.split(entry.Action.Ratio)
+			case LedgerSecurityTransfer:
+				if op.OperationType == sdk.OperationTypeSecurityIn {
+					item.transferIn(op, opts.TransferPrices[op.FIGI])
+				} else {
+					item.transferOut(op, itemCostBasis)
+				}
+			case LedgerFee:
+				if ticker == "" {
+					// account level fees may come in any currency
+					p.TotalFee[Currency(op.Currency)] += op.Payment
+					p.TotalProfit[Currency(op.Currency)] += op.Payment
+					continue
+				}
+				item.Fee += op.Payment
 			}
 		}
+		if currency, ok := item.TradedCurrency(); ok {
+			p.FXProfit[currency] += item.Profit
+		}
 		p.Items = append(p.Items, item)
 	}
 	for i, item := range p.Items {
 		p.TotalFee[item.Currency] += item.Fee
 		p.TotalProfit[item.Currency] += item.TotalProfit()
 		p.TotalDividend[item.Currency] += item.Dividends
+		p.TotalCoupon[item.Currency] += item.Coupons
 		if item.Ticker == "" {
 			continue
 		}
-		if position, ok := portfolio[item.FIGI]; ok && position.Balance > 0 {
+		if position, ok := data.Positions[item.FIGI]; ok && position.Balance > 0 {
 			item.Holdings = position.AveragePositionPrice.Value * position.Balance
 
-			if _, ok := bonds[item.FIGI]; !ok && item.Holdings == 0 {
-
-				for _, pos := range item.LongPositions {
-					item.Holdings += pos
-				}
-				for _, pos := range item.ShortPositions {
-					item.Holdings -= pos
-				}
-				orderbook, err := ti.RestClient.Orderbook(ctx, 1, item.FIGI)
-				if err != nil {
-					return p, errors.Wrapf(err, "failed to get order book for %s", item.Ticker)
-				}
-				item.ExpectedYield = float64(len(item.LongPositions))*orderbook.LastPrice - float64(len(item.ShortPositions))*orderbook.LastPrice - item.Holdings
+			if item.InstrumentType != sdk.InstrumentTypeBond && item.Holdings == 0 {
+				long, short := pricedLots(item.LongPositions), pricedLots(item.ShortPositions)
+				item.Holdings = lotsCost(long) - lotsCost(short)
+				item.ExpectedYield = (lotsQuantity(long)-lotsQuantity(short))*data.Quotes[item.FIGI] - item.Holdings
 			} else {
 				item.ExpectedYield = position.ExpectedYield.Value
 			}
 			p.TotalPosition[item.Currency] += item.Holdings
-			item.ExpectedYieldPc = item.ExpectedYield * 100 / item.Holdings
+			if item.Holdings != 0 {
+				item.ExpectedYieldPc = item.ExpectedYield * 100 / item.Holdings
+			}
 			p.TotalPotentialProfit[item.Currency] += item.ExpectedYield
 			p.Items[i] = item
 		}
 	}
-	return p, nil
+	p.Returns = buildReturns(data)
+	return p
+}
+
+func buildReturns(data PortfolioData) map[Currency]Returns {
+	at := data.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	values := make(map[Currency]float64)
+	for currency, balance := range data.Balances {
+		values[currency] += balance
+	}
+	for _, position := range data.Positions {
+		if position.InstrumentType == sdk.InstrumentTypeCurrency || position.Balance <= 0 {
+			continue
+		}
+		currency, value := positionValue(position, data.Quotes)
+		values[currency] += value
+	}
+	var curves map[Currency][]EquityPoint
+	if data.Prices != nil {
+		curves = EquityCurve(data.Operations, data.Instruments, data.Prices, at)
+	}
+	returns := make(map[Currency]Returns)
+	for currency, flows := range CashFlows(data.Operations, data.Instruments) {
+		r := Returns{Currency: currency, Value: values[currency]}
+		for _, flow := range flows {
+			r.Invested += flow.Amount
+		}
+		r.XIRR, r.HasXIRR = XIRR(flows, r.Value, at)
+		if curve, ok := curves[currency]; ok {
+			r.TWR, r.HasTWR = TWR(curve)
+		}
+		returns[currency] = r
+	}
+	return returns
+}
+
+func (item PortfolioItem) formatLot(lot Lot, sign float64, now time.Time) string {
+	return fmt.Sprintf(
+		"%s %s по %s%.2f (ком %s) %dдн\n",
+		lot.Date.Format("2006/01/02"), item.formatQuantity(sign*lot.Quantity), item.Currency.Sign(), lot.Price,
+		formatMoney(item.Currency, lot.Fee), holdingDays(lot.HoldingPeriod(now)),
+	)
+}
+
+func (item PortfolioItem) formatQuantity(quantity float64) string {
+	if currency, ok := item.TradedCurrency(); ok {
+		return fmt.Sprintf("%s%.2f", currency.Sign(), quantity)
+	}
+	return fmt.Sprintf("%gшт", quantity)
+}
+
+func holdingDays(d time.Duration) int {
+	return int(d / (24 * time.Hour))
 }
 
 func formatMoney(cur Currency, val float64) string {
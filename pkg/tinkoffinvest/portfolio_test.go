@@ -0,0 +1,86 @@
+package tinkoffinvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// portfolioFixture is recorded API data along with the options a portfolio is built with.
+type portfolioFixture struct {
+	Data             PortfolioData      `json:"data"`
+	TransferPrices   map[string]float64 `json:"transfer_prices"`
+	CorporateActions []struct {
+		Date    time.Time `json:"date"`
+		OldFIGI string    `json:"old_figi"`
+		NewFIGI string    `json:"new_figi"`
+		Ratio   float64   `json:"ratio"`
+	} `json:"corporate_actions"`
+}
+
+func (f portfolioFixture) options() PortfolioOptions {
+	opts := PortfolioOptions{TransferPrices: f.TransferPrices}
+	for i, action := range f.CorporateActions {
+		opts.CorporateActions = append(opts.CorporateActions, CorporateAction{
+			ID:      int64(i + 1),
+			Date:    action.Date,
+			OldFIGI: action.OldFIGI,
+			NewFIGI: action.NewFIGI,
+			Ratio:   action.Ratio,
+		})
+	}
+	return opts
+}
+
+func TestBuildPortfolioGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "portfolio", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range fixtures {
+		if strings.HasSuffix(path, ".golden.json") {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture portfolioFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("failed to parse %s: %v", path, err)
+			}
+			var got bytes.Buffer
+			if err := BuildPortfolio(fixture.Data, fixture.options()).WriteJSON(&got); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, strings.TrimSuffix(path, ".json")+".golden.json", got.Bytes())
+		})
+	}
+}
+
+// assertGolden compares got with the golden file, rewriting it instead with -update.
+func assertGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v, run with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run with -update and review the diff\n%s", golden, got)
+	}
+}
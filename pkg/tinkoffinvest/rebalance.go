@@ -0,0 +1,326 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/pkg/errors"
+)
+
+// TargetWeight is the desired share in percent of a ticker or of an asset class, see assetClasses.
+type TargetWeight struct {
+	Target string  `json:"target"`
+	Weight float64 `json:"weight"`
+}
+
+// assetClasses are target names that refer to all held instruments of a type rather than a ticker.
+var assetClasses = map[string]sdk.InstrumentType{
+	"stocks": sdk.InstrumentTypeStock,
+	"bonds":  sdk.InstrumentTypeBond,
+	"etfs":   sdk.InstrumentTypeEtf,
+}
+
+// AssetClass returns the instrument type a target name refers to.
+func AssetClass(target string) (sdk.InstrumentType, bool) {
+	t, ok := assetClasses[strings.ToLower(target)]
+	return t, ok
+}
+
+// RebalanceOrder is a proposed trade, Lots is negative for a sale.
+type RebalanceOrder struct {
+	Ticker   string   `json:"ticker"`
+	FIGI     string   `json:"figi"`
+	Currency Currency `json:"currency"`
+	Lots     int      `json:"lots"`
+	LotSize  int      `json:"lot_size"`
+	Price    float64  `json:"price"`
+	// Value, CurrentWeight and TargetWeight are in the base currency of the plan.
+	Value         float64 `json:"value"`
+	CurrentWeight float64 `json:"current_weight"`
+	TargetWeight  float64 `json:"target_weight"`
+}
+
+// RebalancePlan lists trades bringing targeted holdings to their weights.
+type RebalancePlan struct {
+	BaseCurrency Currency         `json:"base_currency"`
+	Total        float64          `json:"total"`
+	Orders       []RebalanceOrder `json:"orders"`
+	// CashLeft is what remains of the free and extra cash after all orders.
+	CashLeft float64 `json:"cash_left"`
+	// Skipped explains targets that couldn't be planned.
+	Skipped []string `json:"skipped"`
+}
+
+type rebalanceHolding struct {
+	instrument sdk.Instrument
+	typ        sdk.InstrumentType
+	quantity   float64
+	price      float64
+	// value is in the base currency
+	value  float64
+	target float64
+	// hasTarget tells a zero weight, which sells the holding, from no weight at all
+	hasTarget bool
+}
+
+// Rebalance fetches positions and last prices and plans trades to reach targets investing extra cash in RUB.
+func (ti *TinkoffInvest) Rebalance(ctx context.Context, accountID string, targets []TargetWeight, cash float64) (RebalancePlan, error) {
+	data, err := ti.PortfolioData(ctx, accountID)
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+	figis := make(map[string]struct{})
+	for figi, position := range data.Positions {
+		if position.InstrumentType != sdk.InstrumentTypeCurrency && position.Balance > 0 {
+			figis[figi] = struct{}{}
+		}
+	}
+	catalog := data.Instruments.byTicker()
+	for _, target := range targets {
+		if instrument, ok := catalog[strings.ToUpper(target.Target)]; ok {
+			figis[instrument.FIGI] = struct{}{}
+		}
+	}
+	bonds := make(map[string]struct{})
+	for _, bond := range data.Instruments.Bonds {
+		bonds[bond.FIGI] = struct{}{}
+	}
+	prices := make(map[string]float64)
+	for figi := range figis {
+		orderbook, err := ti.Broker.Orderbook(ctx, 1, figi)
+		if err != nil {
+			return RebalancePlan{}, errors.Wrapf(err, "failed to get order book for %s", figi)
+		}
+		_, isBond := bonds[figi]
+		prices[figi] = orderbookPrice(orderbook, isBond)
+	}
+	return PlanRebalance(data, prices, targets, cash, RUB), nil
+}
+
+// orderbookPrice is the last price of a unit in the instrument currency, bonds are quoted in percent of face value.
+func orderbookPrice(orderbook sdk.RestOrderBook, isBond bool) float64 {
+	price := orderbook.LastPrice
+	if price == 0 {
+		price = orderbook.ClosePrice
+	}
+	if isBond && orderbook.FaceValue > 0 {
+		price *= orderbook.FaceValue / 100
+	}
+	return price
+}
+
+func (i Instruments) byTicker() map[string]sdk.Instrument {
+	instruments := make(map[string]sdk.Instrument)
+	for _, list := range [][]sdk.Instrument{i.Stocks, i.Bonds, i.ETFs} {
+		for _, instrument := range list {
+			instruments[instrument.Ticker] = instrument
+		}
+	}
+	return instruments
+}
+
+// PlanRebalance treats weights as shares of the whole portfolio plus free and extra cash, leaves untargeted holdings as is,
+// sells first and then buys with cash and sale proceeds in whole lots, largest shortfall first.
+func PlanRebalance(data PortfolioData, prices map[string]float64, targets []TargetWeight, cash float64, baseCurrency Currency) RebalancePlan {
+	plan := RebalancePlan{BaseCurrency: baseCurrency, Orders: make([]RebalanceOrder, 0), Skipped: make([]string, 0)}
+	types := make(map[string]sdk.InstrumentType)
+	byFIGI := make(map[string]sdk.Instrument)
+	for instrumentType, list := range map[sdk.InstrumentType][]sdk.Instrument{
+		sdk.InstrumentTypeStock: data.Instruments.Stocks,
+		sdk.InstrumentTypeBond:  data.Instruments.Bonds,
+		sdk.InstrumentTypeEtf:   data.Instruments.ETFs,
+	} {
+		for _, instrument := range list {
+			types[instrument.FIGI] = instrumentType
+			byFIGI[instrument.FIGI] = instrument
+		}
+	}
+	toBase := func(amount float64, currency Currency) (float64, bool) {
+		return data.Rates.Convert(amount, currency, baseCurrency)
+	}
+
+	holdings := make(map[string]*rebalanceHolding)
+	available := cash
+	for currency, balance := range data.Balances {
+		if balance <= 0 {
+			continue
+		}
+		value, ok := toBase(balance, currency)
+		if !ok {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: нет курса валюты", currency))
+			continue
+		}
+		available += value
+	}
+	plan.Total = available
+	for figi, position := range data.Positions {
+		if position.InstrumentType == sdk.InstrumentTypeCurrency || position.Balance <= 0 {
+			continue
+		}
+		instrument, ok := byFIGI[figi]
+		if !ok {
+			continue
+		}
+		h := &rebalanceHolding{instrument: instrument, typ: types[figi], quantity: position.Balance, price: prices[figi]}
+		value, ok := toBase(h.quantity*h.price, Currency(instrument.Currency))
+		if !ok || h.price <= 0 {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: нет цены или курса валюты", instrument.Ticker))
+			continue
+		}
+		h.value = value
+		holdings[figi] = h
+		plan.Total += value
+	}
+
+	catalog := data.Instruments.byTicker()
+	// tickers go first, so asset classes are spread only over holdings without a weight of their own
+	ordered := make([]TargetWeight, len(targets))
+	copy(ordered, targets)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		_, iClass := AssetClass(ordered[i].Target)
+		_, jClass := AssetClass(ordered[j].Target)
+		return !iClass && jClass
+	})
+	var weights float64
+	for _, target := range ordered {
+		weights += target.Weight
+		if class, ok := AssetClass(target.Target); ok {
+			var classValue float64
+			members := make([]*rebalanceHolding, 0)
+			for _, h := range holdings {
+				if h.typ == class && !h.hasTarget && h.value > 0 {
+					classValue += h.value
+					members = append(members, h)
+				}
+			}
+			if len(members) == 0 {
+				plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: нет позиций этого класса, задайте вес тикерам", target.Target))
+				continue
+			}
+			for _, h := range members {
+				h.target += target.Weight * h.value / classValue
+				h.hasTarget = true
+			}
+			continue
+		}
+		instrument, ok := catalog[strings.ToUpper(target.Target)]
+		if !ok {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: инструмент не найден", target.Target))
+			continue
+		}
+		h, ok := holdings[instrument.FIGI]
+		if !ok {
+			if prices[instrument.FIGI] <= 0 {
+				plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: нет цены", instrument.Ticker))
+				continue
+			}
+			h = &rebalanceHolding{instrument: instrument, typ: types[instrument.FIGI], price: prices[instrument.FIGI]}
+			holdings[instrument.FIGI] = h
+		}
+		h.target += target.Weight
+		h.hasTarget = true
+	}
+	if weights > 100+lotEpsilon {
+		plan.Skipped = append(plan.Skipped, fmt.Sprintf("сумма весов %.2f%% больше 100%%", weights))
+	}
+
+	sells := make([]RebalanceOrder, 0)
+	buys := make([]RebalanceOrder, 0)
+	for _, h := range holdings {
+		if !h.hasTarget {
+			continue
+		}
+		lotSize := h.instrument.Lot
+		if lotSize <= 0 {
+			lotSize = 1
+		}
+		lotValue, ok := toBase(h.price*float64(lotSize), Currency(h.instrument.Currency))
+		if !ok || lotValue <= 0 {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: нет курса валюты", h.instrument.Ticker))
+			continue
+		}
+		order := RebalanceOrder{
+			Ticker:       h.instrument.Ticker,
+			FIGI:         h.instrument.FIGI,
+			Currency:     Currency(h.instrument.Currency),
+			LotSize:      lotSize,
+			Price:        h.price,
+			TargetWeight: h.target,
+		}
+		if plan.Total > 0 {
+			order.CurrentWeight = h.value * 100 / plan.Total
+		}
+		diff := plan.Total*h.target/100 - h.value
+		if diff < 0 {
+			// only whole lots held can be sold
+			order.Lots = -int(math.Min(math.Floor(-diff/lotValue), math.Floor(h.quantity/float64(lotSize))))
+		} else {
+			order.Lots = int(math.Floor(diff / lotValue))
+		}
+		order.Value = float64(order.Lots) * lotValue
+		switch {
+		case order.Lots < 0:
+			sells = append(sells, order)
+		case order.Lots > 0:
+			buys = append(buys, order)
+		}
+	}
+
+	sort.Slice(sells, func(i, j int) bool {
+		return sells[i].Ticker < sells[j].Ticker
+	})
+	for _, order := range sells {
+		available -= order.Value
+		plan.Orders = append(plan.Orders, order)
+	}
+	sort.Slice(buys, func(i, j int) bool {
+		if buys[i].Value == buys[j].Value {
+			return buys[i].Ticker < buys[j].Ticker
+		}
+		return buys[i].Value > buys[j].Value
+	})
+	for _, order := range buys {
+		lotValue := order.Value / float64(order.Lots)
+		if affordable := int(math.Floor((available + lotEpsilon) / lotValue)); affordable < order.Lots {
+			order.Lots = affordable
+			order.Value = float64(order.Lots) * lotValue
+		}
+		if order.Lots <= 0 {
+			continue
+		}
+		available -= order.Value
+		plan.Orders = append(plan.Orders, order)
+	}
+	plan.CashLeft = available
+	return plan
+}
+
+func (plan RebalancePlan) Summary() string {
+	sign := plan.BaseCurrency.Sign()
+	summary := fmt.Sprintf("Стоимость с учетом денег: %s%.2f\n", sign, plan.Total)
+	if len(plan.Orders) == 0 {
+		summary += "Сделки не требуются\n"
+	}
+	for _, order := range plan.Orders {
+		action := "купить"
+		lots := order.Lots
+		if lots < 0 {
+			action = "продать"
+			lots = -lots
+		}
+		summary += fmt.Sprintf(
+			"%s %s %d лот. (%d шт) по %s%.2f = %s%.2f, доля %.2f%% -> %.2f%%\n",
+			order.Ticker, action, lots, lots*order.LotSize, order.Currency.Sign(), order.Price,
+			sign, math.Abs(order.Value), order.CurrentWeight, order.TargetWeight,
+		)
+	}
+	summary += fmt.Sprintf("Останется денег: %s%.2f\n", sign, plan.CashLeft)
+	for _, skipped := range plan.Skipped {
+		summary += "Пропущено: " + skipped + "\n"
+	}
+	return summary
+}
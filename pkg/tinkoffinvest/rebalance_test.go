@@ -0,0 +1,72 @@
+package tinkoffinvest
+
+import (
+	"testing"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+func TestOrderbookPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderbook sdk.RestOrderBook
+		isBond    bool
+		want      float64
+	}{
+		{"stock", sdk.RestOrderBook{LastPrice: 270, FaceValue: 3}, false, 270},
+		{"closed market", sdk.RestOrderBook{ClosePrice: 268}, false, 268},
+		{"bond in percent of face value", sdk.RestOrderBook{LastPrice: 101.5, FaceValue: 1000}, true, 1015},
+		{"amortized bond", sdk.RestOrderBook{LastPrice: 99, FaceValue: 500}, true, 495},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderbookPrice(tt.orderbook, tt.isBond); !approxEqual(got, tt.want) {
+				t.Errorf("price = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanRebalance(t *testing.T) {
+	data := PortfolioData{
+		Instruments: Instruments{
+			Stocks: []sdk.Instrument{
+				{FIGI: "AAPL", Ticker: "AAPL", Currency: sdk.USD, Lot: 1},
+				{FIGI: "SBER", Ticker: "SBER", Currency: sdk.RUB, Lot: 10},
+			},
+			Bonds: []sdk.Instrument{{FIGI: "OFZ", Ticker: "OFZ", Currency: sdk.RUB, Lot: 1}},
+		},
+		Positions: map[string]sdk.PositionBalance{
+			"AAPL": {FIGI: "AAPL", InstrumentType: sdk.InstrumentTypeStock, Balance: 10},
+			"SBER": {FIGI: "SBER", InstrumentType: sdk.InstrumentTypeStock, Balance: 100},
+			"OFZ":  {FIGI: "OFZ", InstrumentType: sdk.InstrumentTypeBond, Balance: 10},
+		},
+		Rates:    Rates{USD: 75},
+		Balances: map[Currency]float64{RUB: 5000, USD: 10},
+	}
+	prices := map[string]float64{"AAPL": 100, "SBER": 250, "OFZ": 1000}
+	// a zero weight sells AAPL and keeps it out of stocks, which leaves SBER alone
+	targets := []TargetWeight{{Target: "AAPL", Weight: 0}, {Target: "stocks", Weight: 20}, {Target: "bonds", Weight: 50}}
+
+	plan := PlanRebalance(data, prices, targets, 0, RUB)
+	// 75000 in AAPL, 25000 in SBER, 10000 in OFZ and 5750 of free cash
+	if !approxEqual(plan.Total, 115750) {
+		t.Errorf("total = %v, want 115750", plan.Total)
+	}
+	want := map[string]int{"AAPL": -10, "OFZ": 47}
+	if len(plan.Orders) != len(want) {
+		t.Fatalf("orders = %+v, want %v", plan.Orders, want)
+	}
+	for _, order := range plan.Orders {
+		if order.Lots != want[order.Ticker] {
+			t.Errorf("%s lots = %d, want %d", order.Ticker, order.Lots, want[order.Ticker])
+		}
+	}
+	// free cash and AAPL proceeds less 47 bonds
+	if !approxEqual(plan.CashLeft, 33750) {
+		t.Errorf("cash left = %v, want 33750", plan.CashLeft)
+	}
+	if len(plan.Skipped) != 0 {
+		t.Errorf("skipped = %v", plan.Skipped)
+	}
+}
@@ -0,0 +1,178 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// CashFlow is money moved into (positive) or out of (negative) a currency of the account.
+type CashFlow struct {
+	Date   time.Time
+	Amount float64
+}
+
+// Returns describes performance of the money held in a single currency of the account.
+type Returns struct {
+	Currency Currency `json:"currency"`
+	// Invested is the net amount deposited, including currency bought for rubles.
+	Invested float64 `json:"invested"`
+	// Value is the current value of positions and cash.
+	Value float64 `json:"value"`
+	// TWR is the cumulative time-weighted return as a fraction, valid if HasTWR is set.
+	TWR    float64 `json:"twr"`
+	HasTWR bool    `json:"has_twr"`
+	// XIRR is the annualized money-weighted return as a fraction, valid if HasXIRR is set.
+	XIRR    float64 `json:"xirr"`
+	HasXIRR bool    `json:"has_xirr"`
+}
+
+// CashFlows extracts external flows per currency: deposits, withdrawals, card purchases and
+// currency conversions, which move money out of one currency and into another.
+func CashFlows(operations []sdk.Operation, instruments Instruments) map[Currency][]CashFlow {
+	currencyFigis := instruments.currencyFigis()
+	flows := make(map[Currency][]CashFlow)
+	for _, op := range operations {
+		if op.Status != sdk.OperationStatusDone {
+			continue
+		}
+		for currency, amount := range operationFlows(op, currencyFigis) {
+			flows[currency] = append(flows[currency], CashFlow{Date: op.DateTime, Amount: amount})
+		}
+	}
+	for _, currencyFlows := range flows {
+		currencyFlows := currencyFlows
+		sort.Slice(currencyFlows, func(i, j int) bool {
+			return currencyFlows[i].Date.Before(currencyFlows[j].Date)
+		})
+	}
+	return flows
+}
+
+func operationFlows(op sdk.Operation, currencyFigis map[string]Currency) map[Currency]float64 {
+	switch op.OperationType {
+	case sdk.OperationTypePayIn, sdk.OperationTypePayOut:
+		return map[Currency]float64{Currency(op.Currency): op.Payment}
+	case sdk.OperationTypeBuyCard:
+		// paid straight from the card, so the money never was on the account before
+		flows := map[Currency]float64{Currency(op.Currency): -op.Payment}
+		if traded, ok := currencyFigis[op.FIGI]; ok {
+			flows[traded] += tradedQuantity(op)
+		}
+		return flows
+	case sdk.BUY, sdk.SELL:
+		if op.InstrumentType != sdk.InstrumentTypeCurrency {
+			return nil
+		}
+		traded, ok := currencyFigis[op.FIGI]
+		if !ok {
+			return nil
+		}
+		quantity := tradedQuantity(op)
+		if op.OperationType == sdk.SELL {
+			quantity = -quantity
+		}
+		return map[Currency]float64{Currency(op.Currency): op.Payment, traded: quantity}
+	}
+	return nil
+}
+
+func tradedQuantity(op sdk.Operation) (quantity float64) {
+	for _, trade := range op.Trades {
+		quantity += float64(trade.Quantity)
+	}
+	return quantity
+}
+
+// XIRR returns the annualized rate at which flows, followed by withdrawing value at the given moment, net to zero.
+func XIRR(flows []CashFlow, value float64, at time.Time) (float64, bool) {
+	if len(flows) == 0 {
+		return 0, false
+	}
+	start := flows[0].Date
+	years := func(t time.Time) float64 {
+		return t.Sub(start).Hours() / 24 / 365
+	}
+	// deposits are investments from the investor's point of view, hence the sign flip
+	npv := func(rate float64) float64 {
+		sum := value / math.Pow(1+rate, years(at))
+		for _, flow := range flows {
+			sum -= flow.Amount / math.Pow(1+rate, years(flow.Date))
+		}
+		return sum
+	}
+	low, high := -0.9999, 10.0
+	lowNPV, highNPV := npv(low), npv(high)
+	if math.IsNaN(lowNPV) || math.IsNaN(highNPV) || lowNPV*highNPV > 0 {
+		return 0, false
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		midNPV := npv(mid)
+		if math.Abs(midNPV) < 1e-7 {
+			return mid, true
+		}
+		if midNPV*lowNPV > 0 {
+			low, lowNPV = mid, midNPV
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, true
+}
+
+// TWR chains daily returns of the equity curve, neutralizing external flows.
+func TWR(curve []EquityPoint) (float64, bool) {
+	growth := 1.0
+	var periods int
+	for i := 1; i < len(curve); i++ {
+		base := curve[i-1].Value + curve[i].Flow
+		if base <= 0 {
+			continue
+		}
+		growth *= curve[i].Value / base
+		periods++
+	}
+	if periods == 0 {
+		return 0, false
+	}
+	return growth - 1, true
+}
+
+// hasTWR reports whether returns were built with price history.
+func (p Portfolio) hasTWR() bool {
+	for _, r := range p.Returns {
+		if r.HasTWR {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Portfolio) ReturnsSummary() string {
+	var summary string
+	for _, currency := range Currencies {
+		r, ok := p.Returns[currency]
+		if !ok || (!r.HasXIRR && !r.HasTWR) {
+			continue
+		}
+		summary += fmt.Sprintf(
+			"%s внесено %s%.2f, стоимость %s%.2f",
+			currency.String(), currency.Sign(), r.Invested, currency.Sign(), r.Value,
+		)
+		if r.HasXIRR {
+			summary += fmt.Sprintf(", XIRR %s%.2f%% годовых", numSign(r.XIRR), r.XIRR*100)
+		}
+		if r.HasTWR {
+			summary += fmt.Sprintf(", TWR %s%.2f%%", numSign(r.TWR), r.TWR*100)
+		}
+		summary += "\n"
+	}
+	if summary == "" {
+		return ""
+	}
+	return "\nДоходность:\n" + summary
+}
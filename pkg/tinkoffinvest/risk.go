@@ -0,0 +1,194 @@
+package tinkoffinvest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// tradingDays annualizes daily volatility.
+const tradingDays = 252
+
+// RiskMetrics describe price swings over a period, Volatility and MaxDrawdown are in percent.
+type RiskMetrics struct {
+	Volatility  float64 `json:"volatility"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	// Beta is valid if HasBeta is set.
+	Beta    float64 `json:"beta"`
+	HasBeta bool    `json:"has_beta"`
+	Days    int     `json:"days"`
+}
+
+// HoldingRisk is risk of a single position, Weight is its share of the portfolio in percent.
+type HoldingRisk struct {
+	Ticker string  `json:"ticker"`
+	FIGI   string  `json:"figi"`
+	Weight float64 `json:"weight"`
+	RiskMetrics
+}
+
+// RiskReport holds risk metrics of every position and of the whole portfolio at current weights.
+type RiskReport struct {
+	Benchmark string        `json:"benchmark"`
+	Portfolio RiskMetrics   `json:"portfolio"`
+	Holdings  []HoldingRisk `json:"holdings"`
+}
+
+// dailyReturns maps a day to the change of close price from the previous candle.
+func dailyReturns(candles []sdk.Candle) map[string]float64 {
+	sorted := make([]sdk.Candle, len(candles))
+	copy(sorted, candles)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].TS.Before(sorted[j].TS)
+	})
+	returns := make(map[string]float64)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].ClosePrice <= 0 {
+			continue
+		}
+		returns[sorted[i].TS.Format("2006-01-02")] = sorted[i].ClosePrice/sorted[i-1].ClosePrice - 1
+	}
+	return returns
+}
+
+// riskMetrics computes metrics of a return series against benchmark returns, which may be nil.
+func riskMetrics(returns, benchmark map[string]float64) RiskMetrics {
+	days := make([]string, 0, len(returns))
+	for day := range returns {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	m := RiskMetrics{Days: len(days)}
+	if len(days) < 2 {
+		return m
+	}
+
+	var mean float64
+	for _, day := range days {
+		mean += returns[day]
+	}
+	mean /= float64(len(days))
+	var variance float64
+	for _, day := range days {
+		variance += (returns[day] - mean) * (returns[day] - mean)
+	}
+	variance /= float64(len(days) - 1)
+	m.Volatility = math.Sqrt(variance*tradingDays) * 100
+
+	value, peak := 1.0, 1.0
+	for _, day := range days {
+		value *= 1 + returns[day]
+		if value > peak {
+			peak = value
+		}
+		if drawdown := (peak - value) / peak * 100; drawdown > m.MaxDrawdown {
+			m.MaxDrawdown = drawdown
+		}
+	}
+
+	common := make([]string, 0, len(days))
+	for _, day := range days {
+		if _, ok := benchmark[day]; ok {
+			common = append(common, day)
+		}
+	}
+	if len(common) < 2 {
+		return m
+	}
+	var meanR, meanB float64
+	for _, day := range common {
+		meanR += returns[day]
+		meanB += benchmark[day]
+	}
+	meanR /= float64(len(common))
+	meanB /= float64(len(common))
+	var covariance, benchmarkVariance float64
+	for _, day := range common {
+		covariance += (returns[day] - meanR) * (benchmark[day] - meanB)
+		benchmarkVariance += (benchmark[day] - meanB) * (benchmark[day] - meanB)
+	}
+	if benchmarkVariance > 0 {
+		m.Beta, m.HasBeta = covariance/benchmarkVariance, true
+	}
+	return m
+}
+
+// BuildRiskReport weighs positions by their current value in rubles and replays the portfolio at those weights
+// over the daily candles given by FIGI.
+func BuildRiskReport(data PortfolioData, candles map[string][]sdk.Candle, benchmarkTicker string, benchmark []sdk.Candle) RiskReport {
+	report := RiskReport{Benchmark: benchmarkTicker, Holdings: make([]HoldingRisk, 0)}
+	benchmarkReturns := dailyReturns(benchmark)
+
+	var total float64
+	values := make(map[string]float64)
+	for figi, position := range data.Positions {
+		if position.InstrumentType == sdk.InstrumentTypeCurrency || position.Balance <= 0 {
+			continue
+		}
+		currency, value := positionValue(position, data.Quotes)
+		converted, ok := data.Rates.Convert(value, currency, RUB)
+		if !ok || converted <= 0 {
+			continue
+		}
+		values[figi] = converted
+		total += converted
+	}
+	if total == 0 {
+		return report
+	}
+
+	returns := make(map[string]map[string]float64)
+	weighted := make(map[string]float64)
+	weights := make(map[string]float64)
+	for figi, value := range values {
+		position := data.Positions[figi]
+		returns[figi] = dailyReturns(candles[figi])
+		holding := HoldingRisk{
+			Ticker:      position.Ticker,
+			FIGI:        figi,
+			Weight:      value * 100 / total,
+			RiskMetrics: riskMetrics(returns[figi], benchmarkReturns),
+		}
+		report.Holdings = append(report.Holdings, holding)
+		for day, r := range returns[figi] {
+			weighted[day] += r * value
+			weights[day] += value
+		}
+	}
+	// days some instruments didn't trade are counted over those that did
+	portfolioReturns := make(map[string]float64)
+	for day, sum := range weighted {
+		portfolioReturns[day] = sum / weights[day]
+	}
+	report.Portfolio = riskMetrics(portfolioReturns, benchmarkReturns)
+	sort.Slice(report.Holdings, func(i, j int) bool {
+		return report.Holdings[i].Weight > report.Holdings[j].Weight
+	})
+	return report
+}
+
+func (m RiskMetrics) String() string {
+	s := fmt.Sprintf("волатильность %.2f%%, просадка %.2f%%", m.Volatility, m.MaxDrawdown)
+	if m.HasBeta {
+		s += fmt.Sprintf(", бета %.2f", m.Beta)
+	}
+	return s
+}
+
+func (r RiskReport) Summary() string {
+	summary := fmt.Sprintf("Портфель: %s\n", r.Portfolio)
+	if r.Benchmark != "" {
+		summary += fmt.Sprintf("Бета относительно %s\n", r.Benchmark)
+	}
+	summary += "\n"
+	for _, h := range r.Holdings {
+		if h.Days < 2 {
+			summary += fmt.Sprintf("%s %.2f%%: недостаточно данных\n", h.Ticker, h.Weight)
+			continue
+		}
+		summary += fmt.Sprintf("%s %.2f%%: %s\n", h.Ticker, h.Weight, h.RiskMetrics)
+	}
+	return summary
+}
@@ -0,0 +1,61 @@
+package tinkoffinvest
+
+import (
+	"math"
+	"testing"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+func dailyCandles(closes ...float64) []sdk.Candle {
+	candles := make([]sdk.Candle, 0, len(closes))
+	for i, price := range closes {
+		candles = append(candles, sdk.Candle{TS: testStart.AddDate(0, 0, i), ClosePrice: price})
+	}
+	return candles
+}
+
+func TestBuildRiskReport(t *testing.T) {
+	position := func(figi string, balance, price float64) sdk.PositionBalance {
+		return sdk.PositionBalance{
+			FIGI: figi, Ticker: figi, InstrumentType: sdk.InstrumentTypeStock, Balance: balance,
+			AveragePositionPrice: sdk.MoneyAmount{Currency: sdk.RUB, Value: price},
+		}
+	}
+	data := PortfolioData{Positions: map[string]sdk.PositionBalance{
+		"SWING":  position("SWING", 10, 100),
+		"STABLE": position("STABLE", 60, 50),
+	}}
+	candles := map[string][]sdk.Candle{
+		// +10%, -10%, +10%
+		"SWING":  dailyCandles(100, 110, 99, 108.9),
+		"STABLE": dailyCandles(50, 50, 50, 50),
+	}
+	// +5%, -5%, +5%
+	benchmark := dailyCandles(100, 105, 99.75, 104.7375)
+
+	report := BuildRiskReport(data, candles, "IMOEX", benchmark)
+	if len(report.Holdings) != 2 || report.Holdings[0].FIGI != "STABLE" || !approxEqual(report.Holdings[0].Weight, 75) {
+		t.Fatalf("holdings = %+v, want STABLE at 75%% first", report.Holdings)
+	}
+	swing := report.Holdings[1].RiskMetrics
+	// sample variance of the returns is 0.04/3
+	if want := math.Sqrt(0.04/3*tradingDays) * 100; !approxEqual(swing.Volatility, want) {
+		t.Errorf("volatility = %v, want %v", swing.Volatility, want)
+	}
+	if !approxEqual(swing.MaxDrawdown, 10) {
+		t.Errorf("max drawdown = %v, want 10", swing.MaxDrawdown)
+	}
+	if !swing.HasBeta || !approxEqual(swing.Beta, 2) {
+		t.Errorf("beta = %v (%v), want 2", swing.Beta, swing.HasBeta)
+	}
+	// a quarter in SWING halves the benchmark swings
+	if !report.Portfolio.HasBeta || !approxEqual(report.Portfolio.Beta, 0.5) || report.Portfolio.Days != 3 {
+		t.Errorf("portfolio = %+v, want beta 0.5 over 3 days", report.Portfolio)
+	}
+
+	// without a benchmark beta is unknown
+	if m := riskMetrics(dailyReturns(candles["SWING"]), nil); m.HasBeta {
+		t.Errorf("beta = %v without a benchmark", m.Beta)
+	}
+}
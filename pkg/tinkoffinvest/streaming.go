@@ -2,6 +2,8 @@ package tinkoffinvest
 
 import (
 	context "context"
+	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -11,17 +13,61 @@ import (
 
 type StreamingClient struct {
 	sync.Mutex
-	ctx           context.Context
-	ctxCancel     context.CancelFunc
-	client        *sdk.StreamingClient
-	events        chan Event
-	commands      chan interface{}
-	subscriptions sync.Map
-	apiKey        string
-	log           *zerolog.Logger
-	connCnt       int
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	client    *sdk.StreamingClient
+	// connecting is closed when the connection attempt in progress ends, nil when none is
+	connecting chan struct{}
+	// pending holds the latest change of each stream commandPipe hasn't applied yet, guarded by pendingMu
+	pending   map[string]subscriptionChange
+	pendingMu sync.Mutex
+	// changed is signalled when pending gets a change
+	changed       chan struct{}
+	subscriptions map[string]*subscription
+	// subscriptionsMu guards subscriptions
+	subscriptionsMu sync.Mutex
+	// active are streams subscribed on activeConn, both are used by commandPipe only
+	active     map[string]struct{}
+	activeConn *sdk.StreamingClient
+	apiKey     string
+	// url is the websocket endpoint, overridden by tests
+	url     string
+	log     *zerolog.Logger
+	connCnt int
+	// resubscribe is signalled when a connection is lost, so commandPipe restores subscriptions
+	resubscribe chan struct{}
+	stateMu     sync.RWMutex
+	state       StreamingState
 }
 
+type ConnectionState string
+
+const (
+	StateConnecting   ConnectionState = "connecting"
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+	// StateFailed means connection attempts keep failing, they are still retried at the longest interval.
+	StateFailed ConnectionState = "failed"
+)
+
+// StreamingState describes the websocket connection health.
+type StreamingState struct {
+	State      ConnectionState
+	Since      time.Time
+	LastError  error
+	Reconnects int
+}
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+	// failedAttempts is how many connection attempts in a row fail before the state becomes StateFailed.
+	failedAttempts = 10
+)
+
+// DefaultCandleInterval is used for price watching.
+const DefaultCandleInterval = sdk.CandleInterval5Min
+
 type CommandSubscribeCandle struct {
 	FIGI     string
 	Interval sdk.CandleInterval
@@ -32,17 +78,77 @@ type CommandUnsubscribeCandle struct {
 	Interval sdk.CandleInterval
 }
 
-type Event struct {
+type CommandSubscribeOrderbook struct {
+	FIGI  string
+	Depth int
+}
+
+type CommandUnsubscribeOrderbook struct {
+	FIGI  string
+	Depth int
+}
+
+type CommandSubscribeInstrumentInfo struct {
+	FIGI string
+}
+
+type CommandUnsubscribeInstrumentInfo struct {
+	FIGI string
+}
+
+// CandleEvent is a candle update, ConnectID tells which connection it came from.
+type CandleEvent struct {
+	ConnectID int
+	sdk.Candle
+}
+
+type OrderbookEvent struct {
 	ConnectID int
-	Data      interface{}
+	sdk.OrderBook
+}
+
+type InstrumentInfoEvent struct {
+	ConnectID int
+	sdk.InstrumentInfo
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag behind before new ones are dropped for it.
+const subscriberBuffer = 100
+
+// consumer receives events of one Subscribe call, only the channel of its kind is set.
+type consumer struct {
+	candles     chan CandleEvent
+	orderbooks  chan OrderbookEvent
+	instruments chan InstrumentInfoEvent
+}
+
+func (cons *consumer) close() {
+	switch {
+	case cons.candles != nil:
+		close(cons.candles)
+	case cons.orderbooks != nil:
+		close(cons.orderbooks)
+	case cons.instruments != nil:
+		close(cons.instruments)
+	}
 }
 
 func NewStreamingClient(apiKey string, log zerolog.Logger) *StreamingClient {
+	return newStreamingClient(apiKey, sdk.StreamingApiURL, log)
+}
+
+func newStreamingClient(apiKey, url string, log zerolog.Logger) *StreamingClient {
 	c := &StreamingClient{
-		apiKey:   apiKey,
-		events:   make(chan Event, 1000),
-		commands: make(chan interface{}, 100),
-		log:      &log,
+		apiKey:  apiKey,
+		url:     url,
+		pending: make(map[string]subscriptionChange),
+		changed: make(chan struct{}, 1),
+		log:     &log,
+
+		subscriptions: make(map[string]*subscription),
+		active:        make(map[string]struct{}),
+		resubscribe:   make(chan struct{}, 1),
+		state:         StreamingState{State: StateConnecting, Since: time.Now()},
 	}
 
 	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
@@ -55,50 +161,251 @@ func (c *StreamingClient) SetApiKey(apiKey string) {
 	c.apiKey = apiKey
 }
 
-func (c *StreamingClient) Events() <-chan Event {
-	return c.events
+// State returns a snapshot of the connection health.
+func (c *StreamingClient) State() StreamingState {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.state
+}
+
+func (c *StreamingClient) setState(state ConnectionState, err error) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state.State != state {
+		c.state.State = state
+		c.state.Since = time.Now()
+	}
+	if err != nil {
+		c.state.LastError = err
+	}
+}
+
+func (c *StreamingClient) disconnected(err error) {
+	c.setState(StateReconnecting, err)
+	c.stateMu.Lock()
+	c.state.Reconnects++
+	c.stateMu.Unlock()
 }
 
+// reconnectDelay doubles with every failed attempt up to maxReconnectDelay, with jitter of up to a half of it,
+// so that clients dropped at once don't reconnect at once.
+func reconnectDelay(attempt int) time.Duration {
+	delay := maxReconnectDelay
+	if attempt < 16 {
+		if d := minReconnectDelay << uint(attempt); d < maxReconnectDelay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// StreamingClient returns the current connection, connecting with backoff if there is none.
+// Only one caller connects, the others wait for it without holding the mutex.
+// It returns nil only when the client is closed.
 func (c *StreamingClient) StreamingClient() *sdk.StreamingClient {
-	c.Lock()
-	defer c.Unlock()
-	if c.client != nil {
-		return c.client
+	for {
+		c.Lock()
+		if c.client != nil || c.ctx.Err() != nil {
+			client := c.client
+			c.Unlock()
+			return client
+		}
+		if c.connecting != nil {
+			connecting := c.connecting
+			c.Unlock()
+			select {
+			case <-c.ctx.Done():
+				return nil
+			case <-connecting:
+			}
+			continue
+		}
+		connecting := make(chan struct{})
+		c.connecting = connecting
+		c.Unlock()
+
+		client, i := c.connect()
+		c.Lock()
+		c.connecting = nil
+		if client != nil && c.ctx.Err() != nil {
+			// closed while connecting
+			client.Close()
+			client = nil
+		}
+		c.client = client
+		c.Unlock()
+		close(connecting)
+		if client != nil {
+			c.setState(StateConnected, nil)
+			go c.readLoop(client, i)
+		}
+		return client
 	}
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-	for ; ; <-ticker.C {
+}
+
+// connect dials until it succeeds or the client is closed, it is run by one caller at a time.
+func (c *StreamingClient) connect() (*sdk.StreamingClient, int) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(reconnectDelay(attempt - 1))
+			select {
+			case <-c.ctx.Done():
+				timer.Stop()
+				return nil, 0
+			case <-timer.C:
+			}
+		}
+		if c.ctx.Err() != nil {
+			return nil, 0
+		}
 		c.connCnt++
-		var err error
-		c.client, err = sdk.NewStreamingClient(c.log, c.apiKey)
+		client, err := sdk.NewStreamingClientCustom(c.log, c.apiKey, c.url)
 		if err != nil {
 			c.log.Printf("failed to connect to ws[%d]: %v\n", c.connCnt, err)
+			if attempt+1 >= failedAttempts {
+				c.setState(StateFailed, err)
+			} else {
+				c.setState(c.State().State, err)
+			}
 			continue
 		}
-		go func(i int) {
-			err := c.client.RunReadLoop(func(event interface{}) error {
-				select {
-				case <-c.ctx.Done():
-					return nil
-				case c.events <- Event{ConnectID: i, Data: event}:
-				}
-				return nil
-			})
-			c.log.Printf("readloop exited[%d] with err=%v\n", i, err)
-			c.Lock()
-			c.client.Close()
-			c.client = nil
-			c.Unlock()
-			c.subscriptions.Range(func(key, value interface{}) bool {
-				sub, ok := value.(*subscription)
-				if !ok || sub == nil {
-					return false
-				}
-				c.commands <- sub.cmd
+		return client, c.connCnt
+	}
+}
+
+func (c *StreamingClient) readLoop(client *sdk.StreamingClient, i int) {
+	err := client.RunReadLoop(func(event interface{}) error {
+		if c.ctx.Err() == nil {
+			c.dispatch(i, event)
+		}
+		return nil
+	})
+	c.log.Printf("readloop exited[%d] with err=%v\n", i, err)
+	c.Lock()
+	client.Close()
+	if c.client == client {
+		c.client = nil
+	}
+	c.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.disconnected(err)
+	// a pending signal already covers this connection
+	select {
+	case c.resubscribe <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands an event to every subscriber of its stream without waiting for any of them.
+func (c *StreamingClient) dispatch(connectID int, event interface{}) {
+	var key string
+	var send func(cons *consumer) bool
+	switch e := event.(type) {
+	case sdk.CandleEvent:
+		key = candlesKey(e.Candle.FIGI, e.Candle.Interval)
+		send = func(cons *consumer) bool {
+			select {
+			case cons.candles <- CandleEvent{ConnectID: connectID, Candle: e.Candle}:
+				return true
+			default:
+				return false
+			}
+		}
+	case sdk.OrderBookEvent:
+		key = orderbookKey(e.OrderBook.FIGI, e.OrderBook.Depth)
+		send = func(cons *consumer) bool {
+			select {
+			case cons.orderbooks <- OrderbookEvent{ConnectID: connectID, OrderBook: e.OrderBook}:
+				return true
+			default:
+				return false
+			}
+		}
+	case sdk.InstrumentInfoEvent:
+		key = instrumentInfoKey(e.Info.FIGI)
+		send = func(cons *consumer) bool {
+			select {
+			case cons.instruments <- InstrumentInfoEvent{ConnectID: connectID, InstrumentInfo: e.Info}:
 				return true
-			})
-		}(c.connCnt)
-		return c.client
+			default:
+				return false
+			}
+		}
+	case sdk.ErrorEvent:
+		c.log.Printf("streaming error[%d]: %+v\n", connectID, e.Error)
+		return
+	default:
+		c.log.Printf("unsupported event type[%d]: %+v\n", connectID, event)
+		return
+	}
+	c.subscriptionsMu.Lock()
+	defer c.subscriptionsMu.Unlock()
+	sub, ok := c.subscriptions[key]
+	if !ok {
+		return
+	}
+	for cons := range sub.subscribers {
+		if !send(cons) {
+			c.log.Printf("subscriber of %s is too slow, event dropped\n", key)
+		}
+	}
+}
+
+// subscriptionChange tells commandPipe that subscribers of a stream changed, commandPipe compares
+// the subscribers left with what is subscribed on the server when it gets to the change, so changes
+// sent concurrently can't leave the server in a stale state whatever order they arrive in.
+type subscriptionChange struct {
+	key         string
+	subscribe   interface{}
+	unsubscribe interface{}
+}
+
+// connection returns the current connection, restoring all subscriptions if it is a new one.
+func (c *StreamingClient) connection() *sdk.StreamingClient {
+	client := c.StreamingClient()
+	if client == nil || client == c.activeConn {
+		return client
+	}
+	c.activeConn = client
+	c.active = make(map[string]struct{})
+	c.subscriptionsMu.Lock()
+	changes := make([]subscriptionChange, 0, len(c.subscriptions))
+	for key, sub := range c.subscriptions {
+		changes = append(changes, subscriptionChange{key: key, subscribe: sub.subscribe, unsubscribe: sub.unsubscribe})
+	}
+	c.subscriptionsMu.Unlock()
+	for _, change := range changes {
+		if c.ctx.Err() != nil {
+			break
+		}
+		if c.runCommand(client, change.subscribe) {
+			c.active[change.key] = struct{}{}
+		}
+	}
+	return client
+}
+
+// apply subscribes or unsubscribes a stream on the server depending on whether it has subscribers now.
+func (c *StreamingClient) apply(change subscriptionChange) {
+	client := c.connection()
+	if client == nil {
+		return
+	}
+	c.subscriptionsMu.Lock()
+	_, wanted := c.subscriptions[change.key]
+	c.subscriptionsMu.Unlock()
+	_, active := c.active[change.key]
+	switch {
+	case wanted && !active:
+		if c.runCommand(client, change.subscribe) {
+			c.active[change.key] = struct{}{}
+		}
+	case !wanted && active:
+		// the stream is forgotten even if the command fails, a new connection won't have it
+		c.runCommand(client, change.unsubscribe)
+		delete(c.active, change.key)
 	}
 }
 
@@ -107,76 +414,177 @@ func (c *StreamingClient) commandPipe() {
 		select {
 		case <-c.ctx.Done():
 			return
-		case cmd := <-c.commands:
-			switch command := cmd.(type) {
-			case CommandSubscribeCandle:
-				if err := c.StreamingClient().SubscribeCandle(command.FIGI, command.Interval, requestID()); err != nil {
-					c.log.Printf("subscribe candle command failed: %v\n", err)
+		case <-c.resubscribe:
+			c.connection()
+		case <-c.changed:
+			c.pendingMu.Lock()
+			changes := c.pending
+			c.pending = make(map[string]subscriptionChange)
+			c.pendingMu.Unlock()
+			for _, change := range changes {
+				if c.ctx.Err() != nil {
+					return
 				}
-			case CommandUnsubscribeCandle:
-				if err := c.StreamingClient().UnsubscribeCandle(command.FIGI, command.Interval, requestID()); err != nil {
-					c.log.Printf("unsubscribe candle command failed: %v\n", err)
-				}
-			default:
-				c.log.Printf("unsupported command type: %+v\n", cmd)
+				c.apply(change)
 			}
 		}
 	}
 }
 
+func (c *StreamingClient) runCommand(client *sdk.StreamingClient, cmd interface{}) bool {
+	var err error
+	switch command := cmd.(type) {
+	case CommandSubscribeCandle:
+		err = client.SubscribeCandle(command.FIGI, command.Interval, requestID())
+	case CommandUnsubscribeCandle:
+		err = client.UnsubscribeCandle(command.FIGI, command.Interval, requestID())
+	case CommandSubscribeOrderbook:
+		err = client.SubscribeOrderbook(command.FIGI, command.Depth, requestID())
+	case CommandUnsubscribeOrderbook:
+		err = client.UnsubscribeOrderbook(command.FIGI, command.Depth, requestID())
+	case CommandSubscribeInstrumentInfo:
+		err = client.SubscribeInstrumentInfo(command.FIGI, requestID())
+	case CommandUnsubscribeInstrumentInfo:
+		err = client.UnsubscribeInstrumentInfo(command.FIGI, requestID())
+	default:
+		c.log.Printf("unsupported command type: %+v\n", cmd)
+		return false
+	}
+	if err != nil {
+		c.log.Printf("command %+v failed: %v\n", cmd, err)
+		return false
+	}
+	return true
+}
+
+// subscription is a server side subscription shared by subscribers, it lasts while any of them is left.
 type subscription struct {
-	subscribers sync.Map
-	cmd         interface{}
+	subscribers map[*consumer]struct{}
+	subscribe   interface{}
+	unsubscribe interface{}
 }
 
-func (c *StreamingClient) SubscribeCandles(figi string, chatID int64) {
-	s, _ := c.subscriptions.LoadOrStore(
-		"candles-"+figi,
-		&subscription{cmd: CommandSubscribeCandle{FIGI: figi, Interval: sdk.CandleInterval5Min}},
-	)
-	sub, ok := s.(*subscription)
-	if !ok || sub == nil {
-		return
-	}
-	if _, ok := sub.subscribers.LoadOrStore(chatID, struct{}{}); ok {
-		return
+// addSubscriber subscribes on the server when the first subscriber arrives.
+func (c *StreamingClient) addSubscriber(key string, cons *consumer, subscribe, unsubscribe interface{}) {
+	c.subscriptionsMu.Lock()
+	sub, ok := c.subscriptions[key]
+	if !ok {
+		sub = &subscription{subscribers: make(map[*consumer]struct{}), subscribe: subscribe, unsubscribe: unsubscribe}
+		c.subscriptions[key] = sub
 	}
-	select {
-	case <-c.ctx.Done():
-		return
-	case c.commands <- sub.cmd:
+	sub.subscribers[cons] = struct{}{}
+	first := len(sub.subscribers) == 1
+	// changes are sent unlocked, commandPipe takes the lock to apply them
+	c.subscriptionsMu.Unlock()
+	if first {
+		c.sendChange(subscriptionChange{key: key, subscribe: subscribe, unsubscribe: unsubscribe})
 	}
 }
 
-func (c *StreamingClient) UnsubscribeCandles(figi string, chatID int64) {
-	s, ok := c.subscriptions.Load("candles-" + figi)
+// removeSubscriber unsubscribes on the server when the last subscriber leaves and closes the subscriber channel.
+func (c *StreamingClient) removeSubscriber(key string, cons *consumer) {
+	c.subscriptionsMu.Lock()
+	sub, ok := c.subscriptions[key]
 	if !ok {
+		c.subscriptionsMu.Unlock()
 		return
 	}
-	sub, ok := s.(*subscription)
-	if !ok || sub == nil {
+	if _, ok := sub.subscribers[cons]; !ok {
+		c.subscriptionsMu.Unlock()
 		return
 	}
-	_, ok = sub.subscribers.Load(chatID)
-	if !ok {
-		return
+	delete(sub.subscribers, cons)
+	// dispatch holds the lock while sending, so nothing is sent after this
+	cons.close()
+	last := len(sub.subscribers) == 0
+	if last {
+		delete(c.subscriptions, key)
+	}
+	c.subscriptionsMu.Unlock()
+	if last {
+		c.sendChange(subscriptionChange{key: key, subscribe: sub.subscribe, unsubscribe: sub.unsubscribe})
 	}
-	sub.subscribers.Delete(chatID)
+}
+
+// subscribe registers cons and returns a function cancelling it, safe to call more than once.
+func (c *StreamingClient) subscribe(key string, cons *consumer, subscribe, unsubscribe interface{}) func() {
+	c.addSubscriber(key, cons, subscribe, unsubscribe)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.removeSubscriber(key, cons)
+		})
+	}
+}
 
+// sendChange queues a change for commandPipe without waiting for it, which may be busy reconnecting.
+// Only the latest change of a stream is kept since apply looks at the subscribers left anyway.
+func (c *StreamingClient) sendChange(change subscriptionChange) {
+	c.pendingMu.Lock()
+	c.pending[change.key] = change
+	c.pendingMu.Unlock()
 	select {
-	case <-c.ctx.Done():
-		return
-	case c.commands <- CommandUnsubscribeCandle{FIGI: figi, Interval: sdk.CandleInterval5Min}:
+	case c.changed <- struct{}{}:
+	default:
 	}
 }
 
+func candlesKey(figi string, interval sdk.CandleInterval) string {
+	return fmt.Sprintf("candles-%s-%s", figi, interval)
+}
+
+func orderbookKey(figi string, depth int) string {
+	return fmt.Sprintf("orderbook-%s-%d", figi, depth)
+}
+
+func instrumentInfoKey(figi string) string {
+	return "info-" + figi
+}
+
+// Subscribe streams candles of the given interval to a new channel, independently of other subscribers
+// of the same FIGI. The channel is closed by cancel or when the client is closed.
+func (c *StreamingClient) Subscribe(figi string, interval sdk.CandleInterval) (<-chan CandleEvent, func()) {
+	cons := &consumer{candles: make(chan CandleEvent, subscriberBuffer)}
+	return cons.candles, c.subscribe(
+		candlesKey(figi, interval), cons,
+		CommandSubscribeCandle{FIGI: figi, Interval: interval},
+		CommandUnsubscribeCandle{FIGI: figi, Interval: interval},
+	)
+}
+
+// SubscribeOrderbook streams order books of the given depth, from 1 to 20.
+func (c *StreamingClient) SubscribeOrderbook(figi string, depth int) (<-chan OrderbookEvent, func()) {
+	cons := &consumer{orderbooks: make(chan OrderbookEvent, subscriberBuffer)}
+	return cons.orderbooks, c.subscribe(
+		orderbookKey(figi, depth), cons,
+		CommandSubscribeOrderbook{FIGI: figi, Depth: depth},
+		CommandUnsubscribeOrderbook{FIGI: figi, Depth: depth},
+	)
+}
+
+// SubscribeInstrumentInfo streams trading status and price limits.
+func (c *StreamingClient) SubscribeInstrumentInfo(figi string) (<-chan InstrumentInfoEvent, func()) {
+	cons := &consumer{instruments: make(chan InstrumentInfoEvent, subscriberBuffer)}
+	return cons.instruments, c.subscribe(
+		instrumentInfoKey(figi), cons,
+		CommandSubscribeInstrumentInfo{FIGI: figi},
+		CommandUnsubscribeInstrumentInfo{FIGI: figi},
+	)
+}
+
 func (c *StreamingClient) StreamingClientClose() {
 	c.ctxCancel()
 	c.Lock()
-	defer c.Unlock()
 	if c.client != nil {
 		c.client.Close()
 	}
-	close(c.commands)
-	close(c.events)
+	c.Unlock()
+	c.subscriptionsMu.Lock()
+	defer c.subscriptionsMu.Unlock()
+	for key, sub := range c.subscriptions {
+		for cons := range sub.subscribers {
+			cons.close()
+		}
+		delete(c.subscriptions, key)
+	}
 }
@@ -0,0 +1,275 @@
+package tinkoffinvest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// fakeStreaming is a websocket server recording commands the way the streaming API receives them.
+type fakeStreaming struct {
+	server *httptest.Server
+	// conns gets every accepted connection
+	conns chan *websocket.Conn
+	// commands gets "<event> <figi>" of every command on any connection
+	commands chan string
+	// closed gets a signal whenever a connection is gone
+	closed chan struct{}
+}
+
+func newFakeStreaming(t *testing.T) *fakeStreaming {
+	f := &fakeStreaming{
+		conns:    make(chan *websocket.Conn, 10),
+		commands: make(chan string, 100),
+		closed:   make(chan struct{}, 10),
+	}
+	var upgrader websocket.Upgrader
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		f.conns <- conn
+		defer func() {
+			f.closed <- struct{}{}
+		}()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var cmd struct {
+				Event string `json:"event"`
+				FIGI  string `json:"figi"`
+			}
+			if err := json.Unmarshal(msg, &cmd); err != nil {
+				t.Errorf("bad command %s: %v", msg, err)
+				continue
+			}
+			f.commands <- cmd.Event + " " + cmd.FIGI
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeStreaming) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+// expect fails unless the next command received is want.
+func (f *fakeStreaming) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-f.commands:
+		if got != want {
+			t.Fatalf("command = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+func (f *fakeStreaming) conn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	select {
+	case conn := <-f.conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a connection")
+		return nil
+	}
+}
+
+func receiveCandle(t *testing.T, events <-chan CandleEvent) CandleEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a candle")
+		return CandleEvent{}
+	}
+}
+
+func TestStreamingClientSharesSubscriptions(t *testing.T) {
+	fake := newFakeStreaming(t)
+	c := newStreamingClient("token", fake.url(), zerolog.Nop())
+	defer c.StreamingClientClose()
+	const interval = sdk.CandleInterval5Min
+
+	first, cancelFirst := c.Subscribe("FIGI1", interval)
+	fake.expect(t, "candle:subscribe FIGI1")
+	conn := fake.conn(t)
+
+	// a second subscriber of the same stream doesn't subscribe again,
+	// the next command on the wire is the one for another FIGI
+	second, cancelSecond := c.Subscribe("FIGI1", interval)
+	_, cancelOther := c.Subscribe("FIGI2", interval)
+	fake.expect(t, "candle:subscribe FIGI2")
+
+	candle := `{"event":"candle","payload":{"figi":"FIGI1","interval":"5min","c":101.5}}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(candle)); err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan CandleEvent{first, second} {
+		if event := receiveCandle(t, events); event.FIGI != "FIGI1" || event.ClosePrice != 101.5 {
+			t.Errorf("event = %+v, want FIGI1 closed at 101.5", event)
+		}
+	}
+
+	// cancelling one of two subscribers keeps the stream
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Error("channel of a cancelled subscriber is open")
+	}
+	_, cancelThird := c.Subscribe("FIGI3", interval)
+	fake.expect(t, "candle:subscribe FIGI3")
+
+	// the last one leaving unsubscribes
+	cancelSecond()
+	fake.expect(t, "candle:unsubscribe FIGI1")
+	cancelOther()
+	fake.expect(t, "candle:unsubscribe FIGI2")
+
+	// after a reconnect only streams with subscribers left are restored
+	conn.Close()
+	fake.conn(t)
+	fake.expect(t, "candle:subscribe FIGI3")
+	_, cancelFourth := c.Subscribe("FIGI4", interval)
+	fake.expect(t, "candle:subscribe FIGI4")
+	if state := c.State(); state.State != StateConnected || state.Reconnects != 1 {
+		t.Errorf("state = %+v, want connected after 1 reconnect", state)
+	}
+
+	cancelThird()
+	fake.expect(t, "candle:unsubscribe FIGI3")
+	cancelFourth()
+	fake.expect(t, "candle:unsubscribe FIGI4")
+}
+
+func TestStreamingClientCloseWhileReconnecting(t *testing.T) {
+	fake := newFakeStreaming(t)
+	url := fake.url()
+	fake.server.Close()
+	c := newStreamingClient("token", url, zerolog.Nop())
+
+	connected := make(chan *sdk.StreamingClient)
+	go func() {
+		connected <- c.StreamingClient()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.State().LastError == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a failed attempt")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the mutex is free during the backoff, so the connection is looked up without waiting for it
+	c.Lock()
+	if c.client != nil {
+		t.Error("client is set before connecting")
+	}
+	c.Unlock()
+
+	c.StreamingClientClose()
+	select {
+	case client := <-connected:
+		if client != nil {
+			t.Error("closed client connected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the reconnect loop to stop")
+	}
+}
+
+func TestStreamingClientSubscribeWhileReconnecting(t *testing.T) {
+	fake := newFakeStreaming(t)
+	url := fake.url()
+	fake.server.Close()
+	c := newStreamingClient("token", url, zerolog.Nop())
+	defer c.StreamingClientClose()
+
+	// commandPipe is stuck in the backoff, subscribers must not wait for it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			_, cancel := c.Subscribe(fmt.Sprintf("FIGI%d", i), sdk.CandleInterval5Min)
+			cancel()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribe blocked while reconnecting")
+	}
+}
+
+func TestStreamingClientReconcilesConcurrentChanges(t *testing.T) {
+	fake := newFakeStreaming(t)
+	c := newStreamingClient("token", fake.url(), zerolog.Nop())
+	defer c.StreamingClientClose()
+	const interval = sdk.CandleInterval5Min
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, cancel := c.Subscribe("FIGI1", interval)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	_, cancel := c.Subscribe("FIGI1", interval)
+	defer cancel()
+	// changes of a batch are applied in any order, a marker sent after the first one is seen
+	// is applied after everything sent for FIGI1
+	_, cancelMarker := c.Subscribe("MARKER1", interval)
+	defer cancelMarker()
+	var markers int
+	subscribed := false
+	for markers < 2 {
+		select {
+		case cmd := <-fake.commands:
+			switch cmd {
+			case "candle:subscribe MARKER1":
+				markers++
+				_, cancelNext := c.Subscribe("MARKER2", interval)
+				defer cancelNext()
+			case "candle:subscribe MARKER2":
+				markers++
+			case "candle:subscribe FIGI1":
+				if subscribed {
+					t.Fatal("FIGI1 is subscribed twice in a row")
+				}
+				subscribed = true
+			case "candle:unsubscribe FIGI1":
+				if !subscribed {
+					t.Fatal("FIGI1 is unsubscribed while not subscribed")
+				}
+				subscribed = false
+			default:
+				t.Fatalf("unexpected command %q", cmd)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the markers")
+		}
+	}
+	if !subscribed {
+		t.Error("FIGI1 has a subscriber but isn't subscribed")
+	}
+}
@@ -0,0 +1,299 @@
+package tinkoffinvest
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/pkg/errors"
+)
+
+// RateHistory holds daily closes of currency instruments in rubles.
+type RateHistory map[Currency][]sdk.Candle
+
+// Rate returns the last close of currency at or before the given day.
+func (h RateHistory) Rate(c Currency, at time.Time) (float64, bool) {
+	if c == RUB {
+		return 1, true
+	}
+	candles := h[c]
+	end := at.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	i := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].TS.Before(end)
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return candles[i-1].ClosePrice, true
+}
+
+// RateHistory fetches daily ruble rates of the currencies in currencyTickers.
+func (ti *TinkoffInvest) RateHistory(ctx context.Context, instruments Instruments, from, to time.Time) (RateHistory, error) {
+	history := make(RateHistory)
+	for figi, currency := range instruments.currencyFigis() {
+		candles, err := ti.DailyCandles(ctx, figi, from, to)
+		if err != nil {
+			return nil, err
+		}
+		history[currency] = candles
+	}
+	return history, nil
+}
+
+// TaxGain is realized profit of a single closed lot, converted to rubles at the rates of both trade dates.
+type TaxGain struct {
+	Ticker     string
+	Currency   Currency
+	Quantity   float64
+	OpenDate   time.Time
+	OpenPrice  float64
+	OpenRate   float64
+	CloseDate  time.Time
+	ClosePrice float64
+	CloseRate  float64
+	// Income, Expense and Fee are in rubles, Expense includes Fee.
+	Income  float64
+	Expense float64
+	Fee     float64
+}
+
+func (g TaxGain) Profit() float64 {
+	return g.Income - g.Expense
+}
+
+// TaxIncome is a dividend or coupon along with the tax withheld at source.
+type TaxIncome struct {
+	Date     time.Time
+	Ticker   string
+	Type     sdk.OperationType
+	Currency Currency
+	Amount   float64
+	Tax      float64
+	Rate     float64
+}
+
+// TaxPayment is tax withheld by the broker, negative for a refund.
+type TaxPayment struct {
+	Date     time.Time
+	Type     sdk.OperationType
+	Currency Currency
+	Amount   float64
+	Rate     float64
+}
+
+// TaxReport lists everything taxable during a calendar year.
+type TaxReport struct {
+	Year     int
+	Gains    []TaxGain
+	Income   []TaxIncome
+	Withheld []TaxPayment
+	// MissingRates is set when some amounts couldn't be converted and are counted as zero.
+	MissingRates bool
+}
+
+// TaxReport builds the tax report of an account for a calendar year.
+func (ti *TinkoffInvest) TaxReport(ctx context.Context, accountID string, year int, opts PortfolioOptions) (TaxReport, error) {
+	data, err := ti.PortfolioData(ctx, accountID)
+	if err != nil {
+		return TaxReport{Year: year}, err
+	}
+	from := data.Time
+	for _, op := range data.Operations {
+		if op.DateTime.Before(from) {
+			from = op.DateTime
+		}
+	}
+	to := time.Date(year+1, 1, 1, 0, 0, 0, 0, data.Time.Location())
+	if to.After(data.Time) {
+		to = data.Time
+	}
+	// a week back covers the holidays the rate of the first day is carried over from
+	rates, err := ti.RateHistory(ctx, data.Instruments, from.Add(-7*24*time.Hour), to)
+	if err != nil {
+		return TaxReport{Year: year}, errors.Wrap(err, "failed to get currency rates")
+	}
+	return BuildTaxReport(data, rates, year, opts), nil
+}
+
+// BuildTaxReport replays operations like BuildPortfolio and keeps only what happened during the year.
+func BuildTaxReport(data PortfolioData, rates RateHistory, year int, opts PortfolioOptions) TaxReport {
+	report := TaxReport{
+		Year:     year,
+		Gains:    make([]TaxGain, 0),
+		Income:   make([]TaxIncome, 0),
+		Withheld: make([]TaxPayment, 0),
+	}
+	rate := func(c Currency, at time.Time) float64 {
+		r, ok := rates.Rate(c, at)
+		if !ok {
+			report.MissingRates = true
+		}
+		return r
+	}
+
+	portfolio := BuildPortfolio(data, opts)
+	for _, item := range portfolio.Items {
+		if item.Ticker == "" {
+			continue
+		}
+		for _, trade := range item.Trades {
+			if trade.Date.Year() != year {
+				continue
+			}
+			for _, closed := range trade.Closed {
+				gain := TaxGain{
+					Ticker:     item.Ticker,
+					Currency:   item.Currency,
+					Quantity:   closed.Quantity,
+					OpenDate:   closed.Lot.Date,
+					OpenPrice:  closed.Lot.Price,
+					OpenRate:   rate(item.Currency, closed.Lot.Date),
+					CloseDate:  closed.Date,
+					ClosePrice: closed.Price,
+					CloseRate:  rate(item.Currency, closed.Date),
+				}
+				openValue := closed.Lot.Price * closed.Quantity * gain.OpenRate
+				closeValue := closed.Price * closed.Quantity * gain.CloseRate
+				gain.Fee = -closed.Lot.Fee*gain.OpenRate - closed.Fee*gain.CloseRate
+				if closed.Short {
+					gain.Income, gain.Expense = openValue, closeValue
+				} else {
+					gain.Income, gain.Expense = closeValue, openValue
+				}
+				gain.Expense += gain.Fee
+				report.Gains = append(report.Gains, gain)
+			}
+		}
+	}
+	sort.SliceStable(report.Gains, func(i, j int) bool {
+		return report.Gains[i].CloseDate.Before(report.Gains[j].CloseDate)
+	})
+
+	tickers := make(map[string]string)
+	for _, list := range [][]sdk.Instrument{data.Instruments.Stocks, data.Instruments.Bonds, data.Instruments.ETFs} {
+		for _, instrument := range list {
+			tickers[instrument.FIGI] = instrument.Ticker
+		}
+	}
+	type incomeKey struct {
+		figi string
+		day  string
+	}
+	withheldAtSource := make(map[incomeKey]float64)
+	for _, op := range data.Operations {
+		if op.Status != sdk.OperationStatusDone || op.DateTime.Year() != year {
+			continue
+		}
+		switch op.OperationType {
+		case sdk.OperationTypeTaxDividend, sdk.OperationTypeTaxCoupon:
+			withheldAtSource[incomeKey{op.FIGI, op.DateTime.Format("2006-01-02")}] -= op.Payment
+		case sdk.OperationTypeTax, sdk.OperationTypeTaxLucre, sdk.OperationTypeTaxBack:
+			report.Withheld = append(report.Withheld, TaxPayment{
+				Date:     op.DateTime,
+				Type:     op.OperationType,
+				Currency: Currency(op.Currency),
+				Amount:   -op.Payment,
+				Rate:     rate(Currency(op.Currency), op.DateTime),
+			})
+		}
+	}
+	for _, op := range data.Operations {
+		if op.Status != sdk.OperationStatusDone || op.DateTime.Year() != year {
+			continue
+		}
+		if op.OperationType != sdk.OperationTypeDividend && op.OperationType != sdk.OperationTypeCoupon {
+			continue
+		}
+		report.Income = append(report.Income, TaxIncome{
+			Date:     op.DateTime,
+			Ticker:   tickers[op.FIGI],
+			Type:     op.OperationType,
+			Currency: Currency(op.Currency),
+			Amount:   op.Payment,
+			Tax:      withheldAtSource[incomeKey{op.FIGI, op.DateTime.Format("2006-01-02")}],
+			Rate:     rate(Currency(op.Currency), op.DateTime),
+		})
+	}
+	sort.SliceStable(report.Income, func(i, j int) bool {
+		return report.Income[i].Date.Before(report.Income[j].Date)
+	})
+	sort.SliceStable(report.Withheld, func(i, j int) bool {
+		return report.Withheld[i].Date.Before(report.Withheld[j].Date)
+	})
+	return report
+}
+
+// Tables lays the report out for export.
+func (r TaxReport) Tables() []Table {
+	gains := Table{
+		Name: "Сделки",
+		Header: []string{
+			"Тикер", "Валюта", "Количество",
+			"Дата покупки", "Цена покупки", "Курс покупки",
+			"Дата продажи", "Цена продажи", "Курс продажи",
+			"Доход, руб", "Расход, руб", "в т.ч. комиссии, руб", "Прибыль, руб",
+		},
+	}
+	var totalGain float64
+	for _, g := range r.Gains {
+		gains.Rows = append(gains.Rows, []interface{}{
+			g.Ticker, string(g.Currency), g.Quantity,
+			formatDate(g.OpenDate), g.OpenPrice, g.OpenRate,
+			formatDate(g.CloseDate), g.ClosePrice, g.CloseRate,
+			g.Income, g.Expense, g.Fee, g.Profit(),
+		})
+		totalGain += g.Profit()
+	}
+
+	income := Table{
+		Name: "Доходы",
+		Header: []string{
+			"Дата", "Тикер", "Тип", "Валюта", "Сумма", "Налог у источника", "Курс", "Сумма, руб", "Налог у источника, руб",
+		},
+	}
+	var totalIncome, totalForeignTax float64
+	for _, i := range r.Income {
+		income.Rows = append(income.Rows, []interface{}{
+			formatDate(i.Date), i.Ticker, string(i.Type), string(i.Currency),
+			i.Amount, i.Tax, i.Rate, i.Amount * i.Rate, i.Tax * i.Rate,
+		})
+		totalIncome += i.Amount * i.Rate
+		totalForeignTax += i.Tax * i.Rate
+	}
+
+	withheld := Table{
+		Name:   "Удержанный налог",
+		Header: []string{"Дата", "Тип", "Валюта", "Сумма", "Курс", "Сумма, руб"},
+	}
+	var totalWithheld float64
+	for _, t := range r.Withheld {
+		withheld.Rows = append(withheld.Rows, []interface{}{
+			formatDate(t.Date), string(t.Type), string(t.Currency), t.Amount, t.Rate, t.Amount * t.Rate,
+		})
+		totalWithheld += t.Amount * t.Rate
+	}
+
+	totals := Table{
+		Name:   "Итого",
+		Header: []string{"Показатель", "Сумма, руб"},
+		Rows: [][]interface{}{
+			{"Год", strconv.Itoa(r.Year)},
+			{"Прибыль по сделкам", totalGain},
+			{"Дивиденды и купоны", totalIncome},
+			{"Налог, удержанный у источника", totalForeignTax},
+			{"Налог, удержанный брокером", totalWithheld},
+		},
+	}
+	if r.MissingRates {
+		totals.Rows = append(totals.Rows, []interface{}{"Внимание", "не для всех дат найден курс валюты"})
+	}
+	return []Table{totals, gains, income, withheld}
+}
+
+// WriteCSV writes all report tables one after another.
+func (r TaxReport) WriteCSV(w io.Writer) error {
+	return WriteCSV(w, r.Tables())
+}
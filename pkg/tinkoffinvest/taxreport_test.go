@@ -0,0 +1,43 @@
+package tinkoffinvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// taxReportFixture is recorded API data with daily currency rates and the year to report.
+type taxReportFixture struct {
+	portfolioFixture
+	Rates RateHistory `json:"rates"`
+	Year  int         `json:"year"`
+}
+
+func TestBuildTaxReportGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "taxreport", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture taxReportFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("failed to parse %s: %v", path, err)
+			}
+			report := BuildTaxReport(fixture.Data, fixture.Rates, fixture.Year, fixture.options())
+			var got bytes.Buffer
+			if err := report.WriteCSV(&got); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, strings.TrimSuffix(path, ".json")+".golden.csv", got.Bytes())
+		})
+	}
+}
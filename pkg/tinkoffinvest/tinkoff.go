@@ -8,13 +8,40 @@ import (
 	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
 )
 
+// Broker is the subset of the REST API used to compute a portfolio, satisfied by *sdk.RestClient.
+type Broker interface {
+	PositionsPortfolio(ctx context.Context, accountID string) ([]sdk.PositionBalance, error)
+	Stocks(ctx context.Context) ([]sdk.Instrument, error)
+	Bonds(ctx context.Context) ([]sdk.Instrument, error)
+	ETFs(ctx context.Context) ([]sdk.Instrument, error)
+	Currencies(ctx context.Context) ([]sdk.Instrument, error)
+	Operations(ctx context.Context, accountID string, from, to time.Time, figi string) ([]sdk.Operation, error)
+	Orderbook(ctx context.Context, depth int, figi string) (sdk.RestOrderBook, error)
+	CurrenciesPortfolio(ctx context.Context, accountID string) ([]sdk.CurrencyBalance, error)
+	Candles(ctx context.Context, from, to time.Time, interval sdk.CandleInterval, figi string) ([]sdk.Candle, error)
+}
+
 type TinkoffInvest struct {
 	RestClient *sdk.RestClient
+	Broker     Broker
+	// HistoryStart is where operations history begins, DefaultHistoryStart if zero.
+	HistoryStart time.Time
+	// OperationsStore is optional, operations are downloaded in full on every call without it.
+	OperationsStore OperationsStore
+	// InstrumentsCache is optional, the catalog is downloaded on every call without it.
+	InstrumentsCache InstrumentsSource
+}
+
+// InstrumentsSource supplies the instrument catalog, e.g. from a cache refreshed in background.
+type InstrumentsSource interface {
+	Instruments(ctx context.Context) (Instruments, error)
 }
 
 func NewAPI(apiKey string) *TinkoffInvest {
+	restClient := sdk.NewRestClient(apiKey)
 	t := &TinkoffInvest{
-		RestClient: sdk.NewRestClient(apiKey),
+		RestClient: restClient,
+		Broker:     restClient,
 	}
 
 	return t
@@ -34,10 +61,15 @@ func (ti *TinkoffInvest) InstrumentByTicker(ctx context.Context, ticker string)
 }
 
 type Trade struct {
-	Date     time.Time
-	Type     string
-	Profit   float64
-	ProfitPc float64
+	Date          time.Time     `json:"date"`
+	Type          string        `json:"type"`
+	Quantity      float64       `json:"quantity"`
+	Profit        float64       `json:"profit"`
+	ProfitPc      float64       `json:"profit_pc"`
+	Fee           float64       `json:"fee"`
+	HoldingPeriod time.Duration `json:"holding_period"`
+	// Closed lists lots matched by the trade.
+	Closed []ClosedLot `json:"closed"`
 }
 
 var Currencies = []Currency{
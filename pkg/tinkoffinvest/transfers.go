@@ -0,0 +1,45 @@
+package tinkoffinvest
+
+import (
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// transferQuantity is the number of units moved by a securities transfer.
+func transferQuantity(op sdk.Operation) float64 {
+	if quantity := tradedQuantity(op); quantity > 0 {
+		return quantity
+	}
+	return float64(op.Quantity)
+}
+
+// transferIn opens a lot for securities moved in from another broker at the given purchase price.
+func (item *PortfolioItem) transferIn(op sdk.Operation, price float64) {
+	quantity := transferQuantity(op)
+	if quantity < lotEpsilon {
+		return
+	}
+	item.Invested += price * quantity
+	item.LongPositions = append(item.LongPositions, Lot{
+		Date:        op.DateTime,
+		Quantity:    quantity,
+		Price:       price,
+		Fee:         op.Commission.Value,
+		OperationID: op.ID,
+	})
+}
+
+// transferOut removes lots moved out to another broker without realizing any profit.
+func (item *PortfolioItem) transferOut(op sdk.Operation, costBasis CostBasis) {
+	_, item.LongPositions = costBasis.Take(item.LongPositions, transferQuantity(op), op)
+}
+
+// pricedLots leaves out lots transferred in without a purchase price, whose profit is unknown.
+func pricedLots(lots []Lot) []Lot {
+	priced := make([]Lot, 0, len(lots))
+	for _, lot := range lots {
+		if lot.Price > 0 {
+			priced = append(priced, lot)
+		}
+	}
+	return priced
+}
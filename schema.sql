@@ -44,3 +44,62 @@ CREATE TABLE IF NOT EXISTS sent_notifications (
 );
 
 CREATE UNIQUE INDEX sent_notifications_unique_idx ON sent_notifications (chat_id, ticker, notification_type);
+
+CREATE TABLE IF NOT EXISTS operations (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  account_id varchar NOT NULL,
+  operation_id varchar NOT NULL,
+  date_time timestamp with time zone NOT NULL,
+  status varchar NOT NULL,
+  data jsonb NOT NULL
+);
+
+CREATE UNIQUE INDEX operations_unique_idx ON operations (chat_id, account_id, operation_id);
+
+CREATE TABLE IF NOT EXISTS operations_synced (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  account_id varchar NOT NULL,
+  synced_to timestamp with time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX operations_synced_unique_idx ON operations_synced (chat_id, account_id);
+
+CREATE TABLE IF NOT EXISTS default_accounts (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  account_id varchar NOT NULL
+);
+
+CREATE UNIQUE INDEX default_accounts_unique_idx ON default_accounts (chat_id);
+
+CREATE TABLE IF NOT EXISTS transfer_prices (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  figi varchar NOT NULL,
+  ticker varchar NOT NULL,
+  price double precision NOT NULL
+);
+
+CREATE UNIQUE INDEX transfer_prices_unique_idx ON transfer_prices (chat_id, figi);
+
+CREATE TABLE IF NOT EXISTS corporate_actions (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  effective_date timestamp with time zone NOT NULL,
+  old_figi varchar NOT NULL,
+  new_figi varchar NOT NULL DEFAULT '',
+  ratio double precision NOT NULL DEFAULT 1
+);
+
+CREATE INDEX corporate_actions_chat_idx ON corporate_actions (chat_id);
+
+CREATE TABLE IF NOT EXISTS target_weights (
+  id serial primary key,
+  chat_id bigint NOT NULL,
+  target varchar NOT NULL,
+  weight double precision NOT NULL
+);
+
+CREATE UNIQUE INDEX target_weights_unique_idx ON target_weights (chat_id, target);